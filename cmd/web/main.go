@@ -5,14 +5,23 @@ import (
 	"bookings/internal/driver"
 	"bookings/internal/handlers"
 	"bookings/internal/helpers"
+	"bookings/internal/mailer"
 	"bookings/internal/models"
+	"bookings/internal/outbox"
 	"bookings/internal/render"
+	"bookings/internal/sessionstore"
+	"bookings/internal/signer"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
@@ -24,6 +33,10 @@ var app config.AppConfig
 var session *scs.SessionManager
 var infoLog *log.Logger
 var errorLog *log.Logger
+var mailWorker *outbox.Worker
+var icalSyncInterval time.Duration
+var sessionStore *sessionstore.DBStore
+var sessionCleanupInterval time.Duration
 
 // main is the main application function
 func main() {
@@ -33,9 +46,26 @@ func main() {
 	}
 	defer db.SQL.Close()
 
-	defer close(app.MailChan)
-	fmt.Println("Starting mail listener...")
-	listenForMail()
+	stopMail := make(chan struct{})
+	defer close(stopMail)
+	mailWorker.Start(15*time.Second, stopMail)
+
+	stopWebhooks := make(chan struct{})
+	defer close(stopWebhooks)
+	handlers.Repo.Webhooks.Start(15*time.Second, stopWebhooks)
+
+	stopSessionCleanup := make(chan struct{})
+	defer close(stopSessionCleanup)
+	if sessionStore != nil {
+		sessionStore.Start(sessionCleanupInterval, stopSessionCleanup)
+	}
+	sessionstore.CleanUserSessions(handlers.Repo.DB, session.Lifetime, sessionCleanupInterval, errorLog, stopSessionCleanup)
+
+	if icalSyncInterval > 0 {
+		stopSync := make(chan struct{})
+		defer close(stopSync)
+		handlers.Repo.ICalSync.Start(icalSyncInterval, stopSync)
+	}
 
 	// emailing by embedded means
 	// from := "me@here.com"
@@ -75,20 +105,114 @@ func run() (*driver.DB, error) {
 	dbPass := flag.String("dbpass", "", "Database password")
 	dbPort := flag.String("dbport", "5432", "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, requere)")
+	secret := flag.String("secret", os.Getenv("BOOKINGS_SECRET"), "Secret key for signing guest links")
+	baseURL := flag.String("baseurl", "http://localhost:8080", "Public URL of the site, used in emails")
+	adminEmail := flag.String("admin-email", "admin@bookings.com", "Address notified about guest changes")
+	cancelFreeDays := flag.Int("cancel-free-days", 2, "Days before arrival guests can cancel for free")
+	cancelFeePercent := flag.Int("cancel-fee-percent", 50, "Percentage of the price charged for late cancellations")
+	smtpHost := flag.String("smtp-host", envOr("SMTP_HOST", "localhost"), "SMTP server host")
+	smtpPort := flag.Int("smtp-port", envInt("SMTP_PORT", 1025), "SMTP server port")
+	smtpUser := flag.String("smtp-user", os.Getenv("SMTP_USER"), "SMTP user name")
+	smtpPass := flag.String("smtp-pass", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	smtpEncryption := flag.String("smtp-encryption", envOr("SMTP_ENCRYPTION", mailer.EncryptionNone), "SMTP encryption (none, ssl, starttls)")
+	mailFrom := flag.String("mail-from", envOr("MAIL_FROM", "me@here.com"), "Sender address of outgoing email")
+	propertyName := flag.String("property-name", "Fort Smyth", "Name of the property in emails and calendar invitations")
+	propertyAddress := flag.String("property-address", "", "Address of the property in calendar invitations")
+	checkIn := flag.String("check-in", "15:00", "Check-in time")
+	checkOut := flag.String("check-out", "11:00", "Check-out time")
+	timezone := flag.String("timezone", "Local", "Time zone of the property, e.g. America/Halifax")
+	icalSync := flag.Duration("ical-sync-interval", 15*time.Minute, "How often external calendars are imported, 0 to disable")
+	mailAttempts := flag.Int("mail-attempts", outbox.DefaultMaxAttempts, "Delivery attempts before an email is marked as failed")
+	loginWindow := flag.Duration("login-window", 15*time.Minute, "How long failed logins count and lockouts last")
+	loginLockout := flag.Int("login-lockout", 10, "Failed logins that lock an account")
+	loginIPLockout := flag.Int("login-ip-lockout", 0, "Failed logins that lock out an IP address, 0 to disable (set -trusted-proxies first when behind a proxy)")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma separated addresses or networks of proxies whose X-Forwarded-For header is trusted, e.g. 10.0.0.0/8")
+	sessionKind := flag.String("session-store", sessionstore.KindMemory, "Where sessions are kept (memory, or postgres to share them between instances and restarts)")
+	sessionCleanup := flag.Duration("session-cleanup-interval", 5*time.Minute, "How often expired sessions are removed from the database")
 
 	flag.Parse()
 
 	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing required flags")
-		os.Exit(1)
+		return nil, errors.New("missing required flags -dbname and -dbuser")
+	}
+	if *sessionKind != sessionstore.KindPostgres && *sessionKind != sessionstore.KindMemory {
+		return nil, fmt.Errorf("unknown -session-store %q, use memory or postgres", *sessionKind)
+	}
+	if *sessionCleanup <= 0 {
+		return nil, errors.New("-session-cleanup-interval must be positive")
 	}
-
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
 
 	// Parameters for runnig the application
 	app.InProduction = *inProduction
 	app.UseCache = *useCache
+	app.BaseURL = strings.TrimSuffix(*baseURL, "/")
+	app.AdminEmail = *adminEmail
+	app.MailFrom = *mailFrom
+	icalSyncInterval = *icalSync
+	sessionCleanupInterval = *sessionCleanup
+	app.CancellationPolicy = models.CancellationPolicy{
+		FreeDays:   *cancelFreeDays,
+		FeePercent: *cancelFeePercent,
+	}
+	app.LoginThrottle = models.LoginThrottle{
+		Window:         *loginWindow,
+		FreeFailures:   3,
+		BaseDelay:      time.Second,
+		MaxDelay:       30 * time.Second,
+		AccountLockout: *loginLockout,
+		IPFreeFailures: 10,
+		IPLockout:      *loginIPLockout,
+	}
+
+	proxies, err := parseTrustedProxies(*trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	app.TrustedProxies = proxies
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return nil, err
+	}
+	checkInTime, err := parseTimeOfDay(*checkIn)
+	if err != nil {
+		return nil, err
+	}
+	checkOutTime, err := parseTimeOfDay(*checkOut)
+	if err != nil {
+		return nil, err
+	}
+	app.Property = models.Property{
+		Name:     *propertyName,
+		Address:  *propertyAddress,
+		CheckIn:  checkInTime,
+		CheckOut: checkOutTime,
+		Location: location,
+	}
+
+	signingKey := []byte(*secret)
+	if len(signingKey) == 0 {
+		// links in emails sent before a restart will stop working
+		log.Println("No -secret given, using a random key for guest links")
+		signingKey = make([]byte, 32)
+		_, err = rand.Read(signingKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	app.Signer = signer.New(signingKey)
+
+	smtp, err := mailer.NewSMTP(mailer.SMTPConfig{
+		Host:       *smtpHost,
+		Port:       *smtpPort,
+		Username:   *smtpUser,
+		Password:   *smtpPass,
+		Encryption: *smtpEncryption,
+	})
+	if err != nil {
+		return nil, err
+	}
+	app.Mailer = smtp
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -124,10 +248,90 @@ func run() (*driver.DB, error) {
 
 	app.TemplateCache = tc
 
+	emailCache, emailTextCache, err := render.CreateEmailTemplateCache()
+	if err != nil {
+		log.Println("cannot create email template cache")
+		return nil, err
+	}
+
+	app.EmailTemplateCache = emailCache
+	app.EmailTextCache = emailTextCache
+
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
+	if *sessionKind == sessionstore.KindPostgres {
+		// sessions survive restarts and are shared by all instances behind a load balancer
+		sessionStore = sessionstore.New(repo.DB, errorLog)
+		session.Store = sessionStore
+	} else {
+		// the sessions kept in memory did not survive the restart, so neither do the browsers recorded for them
+		_, err = repo.DB.DeleteUserSessionsStartedBefore(time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	mailWorker = outbox.NewWorker(repo.DB, app.Mailer, *mailAttempts, errorLog)
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
 	return db, nil
 }
+
+// envOr returns the environment variable key, or def when it is not set
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// envInt returns the environment variable key as a number, or def when it is not set or not a number
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// parseTimeOfDay turns a 15:04 time into the duration since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, use hh:mm", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseTrustedProxies turns a comma separated list of addresses and networks into networks,
+// a single address becoming a network of just that address
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, use an address or network", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, use an address or network", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
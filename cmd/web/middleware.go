@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bookings/internal/handlers"
 	"bookings/internal/helpers"
+	"bookings/internal/permission"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
 )
 
+// sessionSeenInterval is how often the last use of a session is written to the database
+const sessionSeenInterval = time.Minute
+
 // NoSurf adds CSRF protection to all POST requests
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
@@ -18,6 +27,9 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// API clients send JSON, not forms with a token, and authenticate with bearer tokens instead of cookies
+	csrfHandler.ExemptGlob("/api/*")
+
 	return csrfHandler
 }
 
@@ -34,6 +46,80 @@ func Auth(next http.Handler) http.Handler {
 			http.Redirect(w, r, "/users/login", http.StatusSeeOther)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		// the user is loaded on every request, so role changes apply at once
+		user, err := handlers.Repo.DB.GetUserByID(session.GetInt(r.Context(), "user_id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = session.Destroy(r.Context())
+			http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// a password reset bumps the version, ending sessions started before it
+		if session.GetInt(r.Context(), "session_version") != user.SessionVersion {
+			_ = session.Destroy(r.Context())
+			session.Put(r.Context(), "error", "Your password was changed, please log in again")
+			http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+			return
+		}
+
+		if !user.Active {
+			_ = session.Destroy(r.Context())
+			session.Put(r.Context(), "error", "Your account has been deactivated")
+			http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+			return
+		}
+
+		// sessions signed out from another browser, or started before sessions were recorded, end here
+		userSession, err := handlers.Repo.DB.GetUserSessionByToken(session.Token(r.Context()))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && userSession.UserID != user.ID) {
+			_ = session.Destroy(r.Context())
+			session.Put(r.Context(), "error", "You have been signed out, please log in again")
+			http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if time.Since(userSession.LastSeenAt) > sessionSeenInterval {
+			err = handlers.Repo.DB.TouchUserSession(userSession.ID, helpers.ClientIP(r), time.Now())
+			if err != nil {
+				app.ErrorLog.Println("cannot update user session:", err)
+			}
+		}
+
+		if !permission.Can(user.AccessLevel, permission.View) {
+			session.Put(r.Context(), "error", "You do not have access to the admin area")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// owners can require two-factor authentication, which the user must set up before anything else
+		if user.TOTPRequired && !user.TwoFactorEnabled() && !strings.HasPrefix(r.URL.Path, "/admin/profile/two-factor") {
+			session.Put(r.Context(), "error", "Set up two-factor authentication to continue")
+			http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, helpers.WithUser(r, user))
 	})
 }
+
+// Require only lets through users whose role has permission. It must run after Auth.
+func Require(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := helpers.CurrentUser(r)
+			if !permission.Can(user.AccessLevel, perm) {
+				session.Put(r.Context(), "error", "You are not allowed to do that")
+				http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
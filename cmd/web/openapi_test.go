@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bookings/internal/config"
+	"bookings/internal/handlers"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const apiPrefix = "/api/v1"
+
+// apiRoutes returns the API routes of routes() as method and path below apiPrefix
+func apiRoutes(t *testing.T) map[string]bool {
+	var app config.AppConfig
+
+	found := make(map[string]bool)
+	err := chi.Walk(routes(&app).(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, apiPrefix+"/") {
+			found[method+" "+strings.TrimPrefix(route, apiPrefix)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return found
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	spec := handlers.APISpec()
+
+	found := apiRoutes(t)
+	if len(found) == 0 {
+		t.Fatal("no API routes found")
+	}
+
+	for route := range found {
+		method, path, _ := strings.Cut(route, " ")
+		if !spec.HasOperation(method, path) {
+			t.Errorf("%s %s%s is missing from the OpenAPI document", method, apiPrefix, path)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if !found[strings.ToUpper(method)+" "+path] {
+				t.Errorf("the OpenAPI document describes %s %s%s, which is not a route", strings.ToUpper(method), apiPrefix, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferencesExist(t *testing.T) {
+	spec := handlers.APISpec()
+
+	for path, item := range spec.Paths {
+		for method, op := range item {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			}
+			for _, security := range op.Security {
+				for name := range security {
+					if _, ok := spec.Components.SecuritySchemes[name]; !ok {
+						t.Errorf("%s %s uses unknown security scheme %s", method, path, name)
+					}
+				}
+			}
+		}
+	}
+
+	for _, name := range []string{"APIRoom", "APIAvailability", "APIReservationRequest", "APIReservation", "APIError"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bookings/internal/config"
 	"bookings/internal/handlers"
+	"bookings/internal/models"
+	"bookings/internal/permission"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -20,10 +22,20 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/users/login", handlers.Repo.ShowLogin)
 	mux.Post("/users/login", handlers.Repo.PostLogin)
+	mux.Get("/users/login/two-factor", handlers.Repo.ShowLoginTwoFactor)
+	mux.Post("/users/login/two-factor", handlers.Repo.PostLoginTwoFactor)
 	mux.Get("/users/logout", handlers.Repo.Logout)
+	mux.Get("/users/set-password/{token}", handlers.Repo.ShowSetPassword)
+	mux.Post("/users/set-password/{token}", handlers.Repo.PostSetPassword)
+	mux.Get("/users/forgot-password", handlers.Repo.ShowForgotPassword)
+	mux.Post("/users/forgot-password", handlers.Repo.PostForgotPassword)
+	mux.Get("/users/reset-password/{token}", handlers.Repo.ShowResetPassword)
+	mux.Post("/users/reset-password/{token}", handlers.Repo.PostResetPassword)
 	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
+	mux.Get("/rooms", handlers.Repo.Rooms)
+	mux.Get("/rooms/{slug}", handlers.Repo.Room)
+	mux.Get("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently).ServeHTTP)
+	mux.Get("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently).ServeHTTP)
 
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
@@ -37,20 +49,112 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
 
+	mux.Get("/ical/rooms/{id}.ics", handlers.Repo.RoomICalFeed)
+
+	mux.Get("/my-booking/{token}", handlers.Repo.MyBooking)
+	mux.Post("/my-booking/{token}/cancel", handlers.Repo.PostMyBookingCancel)
+	mux.Post("/my-booking/{token}/change", handlers.Repo.PostMyBookingChange)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Get("/openapi.json", handlers.Repo.APIOpenAPI)
+
+		mux.Get("/rooms", handlers.Repo.APIRooms)
+		mux.Get("/rooms/{id}", handlers.Repo.APIRoom)
+		mux.Get("/availability", handlers.Repo.APIAvailability)
+		mux.Post("/reservations", handlers.Repo.APICreateReservation)
+
+		mux.With(handlers.Repo.RequireAPIToken(models.ScopeRead, permission.View)).
+			Get("/reservations/{id}", handlers.Repo.APIReservation)
+		mux.With(handlers.Repo.RequireAPIToken(models.ScopeWrite, permission.EditReservations)).
+			Post("/reservations/{id}/cancel", handlers.Repo.APICancelReservation)
+	})
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router) {
-		// mux.Use(Auth)
+		mux.Use(Auth)
+
 		mux.Get("/dashboard", handlers.Repo.AdminDashbord)
 		mux.Get("/reservations/new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations/all", handlers.Repo.AdminAllReservations)
 		mux.Get("/reservations/calendar", handlers.Repo.AdminReservationsCalendar)
-		mux.Post("/reservations/calendar", handlers.Repo.AdminPostReservationsCalendar)
 		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
-		mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservations/{src}/{id}", handlers.Repo.AdminDeleteReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminUpdateReservation)
+		mux.Get("/rooms", handlers.Repo.AdminRooms)
+		mux.Get("/rooms/{id}", handlers.Repo.AdminShowRoom)
+		mux.Get("/rooms/{id}/rates", handlers.Repo.AdminRoomRates)
+		mux.Get("/stay-rules", handlers.Repo.AdminStayRules)
+		mux.Get("/ical-feeds", handlers.Repo.AdminICalFeeds)
+		mux.Get("/emails/failed", handlers.Repo.AdminFailedEmails)
+
+		mux.Get("/profile", handlers.Repo.AdminProfile)
+		mux.Post("/profile/tokens", handlers.Repo.AdminPostAPIToken)
+		mux.Post("/profile/tokens/{id}/delete", handlers.Repo.AdminDeleteAPIToken)
+		mux.Get("/profile/two-factor", handlers.Repo.AdminTwoFactor)
+		mux.Post("/profile/two-factor", handlers.Repo.AdminPostTwoFactor)
+		mux.Post("/profile/two-factor/recovery-codes", handlers.Repo.AdminRecoveryCodes)
+		mux.Post("/profile/two-factor/disable", handlers.Repo.AdminDisableTwoFactor)
+		mux.Post("/profile/two-factor/forget-devices", handlers.Repo.AdminForgetTrustedDevices)
+		mux.Get("/profile/sessions", handlers.Repo.AdminSessions)
+		mux.Post("/profile/sessions/{id}/sign-out", handlers.Repo.AdminSignOutSession)
+		mux.Post("/profile/sessions/sign-out-all", handlers.Repo.AdminSignOutEverywhere)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Require(permission.EditReservations))
+			mux.Post("/reservations/calendar", handlers.Repo.AdminPostReservationsCalendar)
+			mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminUpdateReservation)
+			mux.Post("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
+			mux.Post("/remind-reservation/{src}/{id}", handlers.Repo.AdminRemindReservation)
+		})
+
+		mux.With(Require(permission.DeleteReservations)).
+			Post("/delete-reservations/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+
+		mux.With(Require(permission.ManageEmails)).
+			Post("/emails/{id}/resend", handlers.Repo.AdminResendEmail)
+
+		mux.With(Require(permission.ViewAudit)).
+			Get("/audit", handlers.Repo.AdminAudit)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Require(permission.ManageRooms))
+			mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+			mux.Post("/rooms/{id}/delete", handlers.Repo.AdminDeleteRoom)
+			mux.Post("/rooms/{id}/ical-token", handlers.Repo.AdminRoomICalToken)
+			mux.Post("/rooms/{id}/rates", handlers.Repo.AdminPostRoomRate)
+			mux.Post("/rooms/{id}/rates/{rateID}/delete", handlers.Repo.AdminDeleteRoomRate)
+
+			mux.Post("/stay-rules", handlers.Repo.AdminPostStayRule)
+			mux.Post("/stay-rules/{id}/delete", handlers.Repo.AdminDeleteStayRule)
+
+			mux.Post("/ical-feeds", handlers.Repo.AdminPostICalFeed)
+			mux.Post("/ical-feeds/{id}/sync", handlers.Repo.AdminSyncICalFeed)
+			mux.Post("/ical-feeds/{id}/delete", handlers.Repo.AdminDeleteICalFeed)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Require(permission.ManageWebhooks))
+			mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+			mux.Post("/webhooks", handlers.Repo.AdminPostWebhook)
+			mux.Get("/webhooks/{id}", handlers.Repo.AdminShowWebhook)
+			mux.Post("/webhooks/{id}", handlers.Repo.AdminUpdateWebhook)
+			mux.Post("/webhooks/{id}/delete", handlers.Repo.AdminDeleteWebhook)
+			mux.Post("/webhooks/{id}/deliveries/{deliveryID}/retry", handlers.Repo.AdminRetryWebhookDelivery)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Require(permission.ManageUsers))
+			mux.Get("/users", handlers.Repo.AdminUsers)
+			mux.Get("/users/{id}", handlers.Repo.AdminShowUser)
+			mux.Post("/users/{id}", handlers.Repo.AdminPostUser)
+			mux.Post("/users/{id}/invite", handlers.Repo.AdminInviteUser)
+			mux.Post("/users/{id}/deactivate", handlers.Repo.AdminDeactivateUser)
+			mux.Post("/users/{id}/activate", handlers.Repo.AdminActivateUser)
+			mux.Post("/users/{id}/reset-two-factor", handlers.Repo.AdminResetUserTwoFactor)
+
+			mux.Get("/logins", handlers.Repo.AdminLogins)
+			mux.Post("/logins/unlock", handlers.Repo.AdminUnlockLogin)
+		})
 	})
 
 	return mux
@@ -0,0 +1,49 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Prefix starts every token, so leaked tokens are easy to recognise
+const Prefix = "bk_"
+
+// displayLength is how much of a token is kept to tell tokens apart in lists
+const displayLength = len(Prefix) + 8
+
+// Generate returns a new random token, the start of it to show in lists, and the hash to store.
+// The token itself is shown to its owner once and never stored.
+func Generate() (token, display, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	token = Prefix + hex.EncodeToString(b)
+	return token, token[:displayLength], Hash(token), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of a token. Tokens are long and random, so a fast
+// hash is enough and lets them be looked up by hash.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FromHeader returns the token of an "Authorization: Bearer <token>" header value
+func FromHeader(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, Prefix) {
+		return "", false
+	}
+
+	return token, true
+}
@@ -0,0 +1,51 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	token, display, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(token, Prefix) || len(token) != len(Prefix)+64 {
+		t.Errorf("unexpected token %q", token)
+	}
+	if !strings.HasPrefix(token, display) || display == token {
+		t.Errorf("display %q should be the start of the token", display)
+	}
+	if hash != Hash(token) {
+		t.Error("hash does not match the token")
+	}
+
+	other, _, _, _ := Generate()
+	if other == token {
+		t.Error("expected different tokens")
+	}
+}
+
+var headerTests = []struct {
+	header string
+	token  string
+	ok     bool
+}{
+	{"Bearer bk_abc", "bk_abc", true},
+	{"bearer bk_abc", "bk_abc", true},
+	{"Bearer  bk_abc ", "bk_abc", true},
+	{"Basic bk_abc", "", false},
+	{"Bearer abc", "", false},
+	{"bk_abc", "", false},
+	{"", "", false},
+}
+
+func TestFromHeader(t *testing.T) {
+	for _, e := range headerTests {
+		token, ok := FromHeader(e.header)
+		if token != e.token || ok != e.ok {
+			t.Errorf("%q: expected %q %v but got %q %v", e.header, e.token, e.ok, token, ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// ignored are fields that change on every write and say nothing about the change itself
+var ignored = map[string]bool{
+	"UpdatedAt": true,
+}
+
+// Diff returns the fields of before and after that differ, each side as a JSON object. A nil side,
+// such as before for something created or after for something deleted, is returned as "".
+func Diff(before, after interface{}) (string, string, error) {
+	b, err := fields(before)
+	if err != nil {
+		return "", "", err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return "", "", err
+	}
+
+	changedBefore := make(map[string]interface{})
+	changedAfter := make(map[string]interface{})
+	for k, v := range b {
+		if ignored[k] {
+			continue
+		}
+		if w, ok := a[k]; !ok || !reflect.DeepEqual(v, w) {
+			changedBefore[k] = v
+		}
+	}
+	for k, v := range a {
+		if ignored[k] {
+			continue
+		}
+		if w, ok := b[k]; !ok || !reflect.DeepEqual(v, w) {
+			changedAfter[k] = v
+		}
+	}
+
+	beforeJSON, err := encode(before, changedBefore)
+	if err != nil {
+		return "", "", err
+	}
+	afterJSON, err := encode(after, changedAfter)
+	if err != nil {
+		return "", "", err
+	}
+
+	return beforeJSON, afterJSON, nil
+}
+
+// fields returns the JSON fields of v, none if v is nil
+func fields(v interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if v == nil {
+		return m, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// encode returns the changed fields of v as JSON, or "" if v is nil
+func encode(v interface{}, changed map[string]interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	b, err := json.Marshal(changed)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+type guest struct {
+	Name      string
+	Email     string
+	Nights    int
+	UpdatedAt time.Time
+}
+
+func TestDiff(t *testing.T) {
+	before := guest{Name: "John", Email: "john@here.com", Nights: 2, UpdatedAt: time.Now()}
+	after := guest{Name: "John", Email: "john@there.com", Nights: 3, UpdatedAt: time.Now().Add(time.Minute)}
+
+	var tests = []struct {
+		name           string
+		before         interface{}
+		after          interface{}
+		expectedBefore string
+		expectedAfter  string
+	}{
+		{"changed", before, after, `{"Email":"john@here.com","Nights":2}`, `{"Email":"john@there.com","Nights":3}`},
+		{"unchanged", before, before, `{}`, `{}`},
+		{"created", nil, guest{Name: "Jane"}, ``, `{"Email":"","Name":"Jane","Nights":0}`},
+		{"deleted", guest{Name: "Jane"}, nil, `{"Email":"","Name":"Jane","Nights":0}`, ``},
+	}
+
+	for _, e := range tests {
+		b, a, err := Diff(e.before, e.after)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if b != e.expectedBefore {
+			t.Errorf("%s: expected before %s but got %s", e.name, e.expectedBefore, b)
+		}
+		if a != e.expectedAfter {
+			t.Errorf("%s: expected after %s but got %s", e.name, e.expectedAfter, a)
+		}
+	}
+}
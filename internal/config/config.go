@@ -1,9 +1,13 @@
 package config
 
 import (
+	"bookings/internal/mailer"
 	"bookings/internal/models"
+	"bookings/internal/signer"
 	"html/template"
 	"log"
+	"net"
+	texttemplate "text/template"
 
 	"github.com/alexedwards/scs/v2"
 )
@@ -12,9 +16,24 @@ import (
 type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	// EmailTemplateCache and EmailTextCache hold the html and plain text variants of the email templates
+	EmailTemplateCache map[string]*template.Template
+	EmailTextCache     map[string]*texttemplate.Template
+	InfoLog            *log.Logger
+	ErrorLog           *log.Logger
+	InProduction       bool
+	Session            *scs.SessionManager
+	Mailer             mailer.Mailer
+	// MailFrom is the sender address of all outgoing email
+	MailFrom string
+	// BaseURL is the public address of the site, used for links in emails
+	BaseURL            string
+	AdminEmail         string
+	Signer             *signer.Signer
+	CancellationPolicy models.CancellationPolicy
+	LoginThrottle      models.LoginThrottle
+	Property           models.Property
+	// TrustedProxies are the networks of the proxies in front of the site, whose
+	// X-Forwarded-For header gives the address of the visitor
+	TrustedProxies []*net.IPNet
 }
@@ -3,11 +3,23 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/asaskevich/govalidator"
 )
 
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+var moneyPattern = regexp.MustCompile(`^\d+(\.\d{1,2})?$`)
+
+// Password policy. bcrypt ignores everything after 72 bytes, so longer passwords are refused.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
 // Form creates a custom form struct and embeds a url.Values object
 type Form struct {
 	url.Values
@@ -62,3 +74,55 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
+
+// IsSlug checks that a field is a lowercase URL slug, such as "generals-quarters"
+func (f *Form) IsSlug(field string) {
+	if !slugPattern.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "Use lowercase letters, numbers and dashes only")
+	}
+}
+
+// IsInt checks that a field holds a whole number no smaller than min
+func (f *Form) IsInt(field string, min int) {
+	n, err := strconv.Atoi(f.Get(field))
+	if err != nil || n < min {
+		f.Errors.Add(field, fmt.Sprintf("This field must be a whole number of at least %d", min))
+	}
+}
+
+// IsMoney checks that a field is an amount with at most two decimals, such as 120.50
+func (f *Form) IsMoney(field string) {
+	if !moneyPattern.MatchString(strings.TrimSpace(f.Get(field))) {
+		f.Errors.Add(field, "Enter an amount such as 120.00")
+	}
+}
+
+// IsURL checks that a field is an absolute http or https address
+func (f *Form) IsURL(field string) {
+	u, err := url.Parse(strings.TrimSpace(f.Get(field)))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		f.Errors.Add(field, "Enter an address starting with http:// or https://")
+	}
+}
+
+// IsPassword checks that a field is a password following the password policy: 8 to 72 characters
+// with at least one letter and one number
+func (f *Form) IsPassword(field string) {
+	password := f.Get(field)
+
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		f.Errors.Add(field, fmt.Sprintf("Use between %d and %d characters", minPasswordLength, maxPasswordLength))
+		return
+	}
+
+	if !strings.ContainsAny(password, "0123456789") || strings.IndexFunc(password, unicode.IsLetter) < 0 {
+		f.Errors.Add(field, "Use at least one letter and one number")
+	}
+}
+
+// Matches checks that a field has the same value as another, such as a password and its confirmation
+func (f *Form) Matches(field, other string) {
+	if f.Get(field) != f.Get(other) {
+		f.Errors.Add(field, "The values do not match")
+	}
+}
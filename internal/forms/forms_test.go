@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -128,3 +129,139 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_IsSlug(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("slug", "generals-quarters")
+	form := New(postedValues)
+
+	form.IsSlug("slug")
+	if !form.Valid() {
+		t.Error("got an invalid slug when we should not have")
+	}
+
+	for _, bad := range []string{"", "Generals", "generals quarters", "-generals", "generals--quarters"} {
+		postedValues = url.Values{}
+		postedValues.Add("slug", bad)
+		form = New(postedValues)
+
+		form.IsSlug("slug")
+		if form.Valid() {
+			t.Errorf("got valid for invalid slug %q", bad)
+		}
+	}
+}
+
+func TestForm_IsInt(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("capacity", "2")
+	form := New(postedValues)
+
+	form.IsInt("capacity", 1)
+	if !form.Valid() {
+		t.Error("got an invalid number when we should not have")
+	}
+
+	for _, bad := range []string{"", "x", "0", "1.5"} {
+		postedValues = url.Values{}
+		postedValues.Add("capacity", bad)
+		form = New(postedValues)
+
+		form.IsInt("capacity", 1)
+		if form.Valid() {
+			t.Errorf("got valid for invalid number %q", bad)
+		}
+	}
+}
+
+func TestForm_IsMoney(t *testing.T) {
+	for _, good := range []string{"120", "120.5", "0.99"} {
+		postedValues := url.Values{}
+		postedValues.Add("rate", good)
+		form := New(postedValues)
+
+		form.IsMoney("rate")
+		if !form.Valid() {
+			t.Errorf("got invalid for valid amount %q", good)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "1.234", "-5", "1,50"} {
+		postedValues := url.Values{}
+		postedValues.Add("rate", bad)
+		form := New(postedValues)
+
+		form.IsMoney("rate")
+		if form.Valid() {
+			t.Errorf("got valid for invalid amount %q", bad)
+		}
+	}
+}
+
+func TestForm_IsURL(t *testing.T) {
+	for _, good := range []string{"https://www.othersite.com/calendar/ical/123.ics?s=abc", "http://localhost:8080/feed"} {
+		postedValues := url.Values{}
+		postedValues.Add("url", good)
+		form := New(postedValues)
+
+		form.IsURL("url")
+		if !form.Valid() {
+			t.Errorf("got invalid for valid url %q", good)
+		}
+	}
+
+	for _, bad := range []string{"", "www.othersite.com/feed", "ftp://othersite.com/feed", "webcal://othersite.com/feed", "https://"} {
+		postedValues := url.Values{}
+		postedValues.Add("url", bad)
+		form := New(postedValues)
+
+		form.IsURL("url")
+		if form.Valid() {
+			t.Errorf("got valid for invalid url %q", bad)
+		}
+	}
+}
+
+func TestForm_IsPassword(t *testing.T) {
+	for _, good := range []string{"correct4horse", "12345abc", strings.Repeat("a1", 36)} {
+		postedValues := url.Values{}
+		postedValues.Add("password", good)
+		form := New(postedValues)
+
+		form.IsPassword("password")
+		if !form.Valid() {
+			t.Errorf("got invalid for valid password %q", good)
+		}
+	}
+
+	for _, bad := range []string{"", "abc123", "correcthorse", "1234567890", strings.Repeat("a1", 37)} {
+		postedValues := url.Values{}
+		postedValues.Add("password", bad)
+		form := New(postedValues)
+
+		form.IsPassword("password")
+		if form.Valid() {
+			t.Errorf("got valid for invalid password %q", bad)
+		}
+	}
+}
+
+func TestForm_Matches(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("password", "correct4horse")
+	postedValues.Add("password_confirm", "correct4horse")
+	form := New(postedValues)
+
+	form.Matches("password_confirm", "password")
+	if !form.Valid() {
+		t.Error("got invalid for matching fields")
+	}
+
+	postedValues.Set("password_confirm", "correct4hors")
+	form = New(postedValues)
+
+	form.Matches("password_confirm", "password")
+	if form.Valid() {
+		t.Error("got valid for fields that do not match")
+	}
+}
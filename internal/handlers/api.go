@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"bookings/internal/apitoken"
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/permission"
+	"bookings/internal/repository"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiDateFormat is the format of every date in API requests and responses
+const apiDateFormat = "2006-01-02"
+
+// maxAPIBody is the largest request body the API reads
+const maxAPIBody = 1 << 20
+
+// API error codes
+const (
+	apiBadRequest    = "bad_request"
+	apiMediaType     = "unsupported_media_type"
+	apiUnauthorized  = "unauthorized"
+	apiForbidden     = "forbidden"
+	apiNotFound      = "not_found"
+	apiInvalid       = "validation_failed"
+	apiUnavailable   = "room_unavailable"
+	apiConflict      = "conflict"
+	apiInternalError = "internal_error"
+)
+
+// apiData wraps the payload of every successful API response
+type apiData struct {
+	Data interface{} `json:"data"`
+}
+
+// writeJSON sends v wrapped in a data envelope
+func (m *Repository) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.Marshal(apiData{Data: v})
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// writeAPIError sends an error envelope
+func writeAPIError(w http.ResponseWriter, status int, code, message string, fields map[string][]string) {
+	out, _ := json.Marshal(models.APIError{Error: models.APIErrorDetail{
+		Code:    code,
+		Message: message,
+		Fields:  fields,
+	}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// apiServerError logs err and sends a 500 error envelope without its details
+func (m *Repository) apiServerError(w http.ResponseWriter, err error) {
+	m.App.ErrorLog.Println(fmt.Sprintf("%s\n%s", err.Error(), debug.Stack()))
+	writeAPIError(w, http.StatusInternalServerError, apiInternalError, "Something went wrong", nil)
+}
+
+// errNotJSON is returned by readJSON for requests whose body is not declared as JSON
+var errNotJSON = errors.New("the Content-Type must be application/json")
+
+// readJSON decodes the request body into v, rejecting bodies of another content type, unknown fields
+// and trailing data
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return errNotJSON
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if dec.Decode(&struct{}{}) != io.EOF {
+		return errors.New("body must contain a single JSON object")
+	}
+
+	return nil
+}
+
+// RequireAPIToken lets through requests with a bearer token that has scope and belongs to a user
+// whose role has perm, the same permission the admin pages check
+func (m *Repository) RequireAPIToken(scope, perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+
+			plain, ok := apitoken.FromHeader(r.Header.Get("Authorization"))
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeAPIError(w, http.StatusUnauthorized, apiUnauthorized, "An API token is required", nil)
+				return
+			}
+
+			token, err := m.DB.GetAPITokenByHash(apitoken.Hash(plain))
+			if errors.Is(err, sql.ErrNoRows) || (err == nil && !now.Before(token.ExpiresAt)) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				writeAPIError(w, http.StatusUnauthorized, apiUnauthorized, "The API token is invalid or has expired", nil)
+				return
+			} else if err != nil {
+				m.apiServerError(w, err)
+				return
+			}
+
+			if !token.Allows(scope, now) {
+				writeAPIError(w, http.StatusForbidden, apiForbidden,
+					fmt.Sprintf("This API token does not have %s access", scope), nil)
+				return
+			}
+			if !token.User.Active || !permission.Can(token.User.AccessLevel, perm) {
+				writeAPIError(w, http.StatusForbidden, apiForbidden, "You do not have access to this resource", nil)
+				return
+			}
+
+			err = m.DB.MarkAPITokenUsed(token.ID, now)
+			if err != nil {
+				m.App.ErrorLog.Println(err)
+			}
+
+			// handlers see the user of the token as the logged in user, so the audit log records them
+			next.ServeHTTP(w, helpers.WithUser(r, token.User))
+		})
+	}
+}
+
+// apiID parses the id URL parameter, sending a 404 if it is not a number
+func apiID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		writeAPIError(w, http.StatusNotFound, apiNotFound, "Not found", nil)
+		return 0, false
+	}
+	return id, true
+}
+
+// parseStay checks the start and end dates of a stay, adding problems to form
+func parseStay(form *forms.Form) (time.Time, time.Time) {
+	start, err := time.Parse(apiDateFormat, form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Must be a date formatted as YYYY-MM-DD")
+	}
+	end, err := time.Parse(apiDateFormat, form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Must be a date formatted as YYYY-MM-DD")
+	}
+
+	if form.Valid() && !end.After(start) {
+		form.Errors.Add("end_date", "Must be after the start date")
+	}
+
+	return start, end
+}
+
+// apiRoom converts a room for API responses
+func apiRoom(room models.Room) models.APIRoom {
+	amenities := room.Amenities
+	if amenities == nil {
+		amenities = []string{}
+	}
+	images := room.Images
+	if images == nil {
+		images = []string{}
+	}
+
+	return models.APIRoom{
+		ID:          room.ID,
+		Name:        room.RoomName,
+		Slug:        room.Slug,
+		Description: room.Description,
+		Capacity:    room.Capacity,
+		Amenities:   amenities,
+		Images:      images,
+		NightlyRate: room.NightlyRate,
+	}
+}
+
+// apiReservation converts a reservation for API responses
+func apiReservation(res models.Reservation) models.APIReservation {
+	lines := []models.APIPriceLine{}
+	for _, line := range res.PriceLines {
+		lines = append(lines, models.APIPriceLine{
+			Date:        line.Date.Format(apiDateFormat),
+			Description: line.Description,
+			Amount:      line.Amount,
+		})
+	}
+
+	return models.APIReservation{
+		ID:              res.ID,
+		RoomID:          res.RoomID,
+		RoomName:        res.Room.RoomName,
+		FirstName:       res.FirstName,
+		LastName:        res.LastName,
+		Email:           res.Email,
+		Phone:           res.Phone,
+		StartDate:       res.StartDate.Format(apiDateFormat),
+		EndDate:         res.EndDate.Format(apiDateFormat),
+		Status:          res.Status,
+		TotalPrice:      res.TotalPrice,
+		CancellationFee: res.CancellationFee,
+		PriceLines:      lines,
+	}
+}
+
+// APIRooms lists all rooms
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	out := []models.APIRoom{}
+	for _, room := range rooms {
+		out = append(out, apiRoom(room))
+	}
+
+	m.writeJSON(w, http.StatusOK, out)
+}
+
+// APIRoom shows one room
+func (m *Repository) APIRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, apiNotFound, "Room not found", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	m.writeJSON(w, http.StatusOK, apiRoom(room))
+}
+
+// APIAvailability lists the rooms that can be booked between the start_date and end_date query parameters,
+// optionally only the room of room_id, with the price of the stay
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.Required("start_date", "end_date")
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiInvalid, "Invalid query", form.Errors)
+		return
+	}
+
+	startDate, endDate := parseStay(form)
+
+	roomID := 0
+	if form.Has("room_id") {
+		var err error
+		roomID, err = strconv.Atoi(form.Get("room_id"))
+		if err != nil {
+			form.Errors.Add("room_id", "Must be a number")
+		}
+	}
+
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiInvalid, "Invalid query", form.Errors)
+		return
+	}
+
+	free, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	freeIDs := make(map[int]bool)
+	for _, room := range free {
+		freeIDs[room.ID] = true
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	available := []models.APIAvailableRoom{}
+	for _, room := range rooms {
+		if !freeIDs[room.ID] || (roomID != 0 && room.ID != roomID) {
+			continue
+		}
+
+		reason, err := m.stayRuleViolation(room.ID, startDate, endDate)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+		if reason != "" {
+			continue
+		}
+
+		quote, err := m.Pricing.QuoteStay(room.ID, startDate, endDate)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		available = append(available, models.APIAvailableRoom{
+			Room:       apiRoom(room),
+			TotalPrice: quote.Total,
+		})
+	}
+
+	m.writeJSON(w, http.StatusOK, models.APIAvailability{
+		StartDate: startDate.Format(apiDateFormat),
+		EndDate:   endDate.Format(apiDateFormat),
+		Rooms:     available,
+	})
+}
+
+// APICreateReservation books a room and queues the confirmation email
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var req models.APIReservationRequest
+	err := readJSON(w, r, &req)
+	if errors.Is(err, errNotJSON) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, apiMediaType, err.Error(), nil)
+		return
+	} else if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiBadRequest, err.Error(), nil)
+		return
+	}
+
+	// validate the body with the same rules as the reservation form
+	form := forms.New(url.Values{
+		"first_name": {req.FirstName},
+		"last_name":  {req.LastName},
+		"email":      {req.Email},
+		"start_date": {req.StartDate},
+		"end_date":   {req.EndDate},
+	})
+	form.Required("first_name", "last_name", "email", "start_date", "end_date")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiInvalid, "Invalid reservation", form.Errors)
+		return
+	}
+
+	startDate, endDate := parseStay(form)
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiInvalid, "Invalid reservation", form.Errors)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(req.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiInvalid, "Invalid reservation",
+			map[string][]string{"room_id": {"No such room"}})
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	reason, err := m.stayRuleViolation(room.ID, startDate, endDate)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+	if reason != "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiInvalid, reason, nil)
+		return
+	}
+
+	quote, err := m.Pricing.QuoteStay(room.ID, startDate, endDate)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	reservation := models.Reservation{
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		Email:      req.Email,
+		Phone:      req.Phone,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		RoomID:     room.ID,
+		Room:       room,
+		TotalPrice: quote.Total,
+		PriceLines: quote.Lines,
+	}
+
+	id, err := m.DB.CreateBooking(reservation, func(id int) (models.MailData, error) {
+		booked := reservation
+		booked.ID = id
+		return m.confirmationEmail(booked)
+	}, reservationEvent(models.EventReservationCreated))
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		writeAPIError(w, http.StatusConflict, apiUnavailable, "The room is not available for these dates", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	reservation.ID = id
+	reservation.Status = models.StatusPending
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", id))
+	m.writeJSON(w, http.StatusCreated, apiReservation(reservation))
+}
+
+// APIReservation shows one reservation
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiLoadReservation(w, r)
+	if !ok {
+		return
+	}
+
+	m.writeJSON(w, http.StatusOK, apiReservation(res))
+}
+
+// APICancelReservation cancels a reservation, charging the fee of the cancellation policy
+func (m *Repository) APICancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiLoadReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if !models.CanTransition(res.Status, models.StatusCancelled) {
+		writeAPIError(w, http.StatusConflict, apiConflict,
+			fmt.Sprintf("A %s reservation cannot be cancelled", res.Status), nil)
+		return
+	}
+
+	fee := m.App.CancellationPolicy.Fee(res, time.Now())
+
+	err := m.auditDB(r).CancelReservation(res.ID, fee, reservationEvent(models.EventReservationCancelled))
+	if errors.Is(err, repository.ErrInvalidStatusTransition) {
+		writeAPIError(w, http.StatusConflict, apiConflict, "The reservation cannot be cancelled", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	res.Status = models.StatusCancelled
+	res.CancellationFee = fee
+	res.Sequence++
+	m.sendEmail(m.cancellationEmail(res))
+
+	m.writeJSON(w, http.StatusOK, apiReservation(res))
+}
+
+// apiLoadReservation loads the reservation of the id URL parameter, sending a 404 if there is none
+func (m *Repository) apiLoadReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, apiNotFound, "Reservation not found", nil)
+		return models.Reservation{}, false
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return models.Reservation{}, false
+	}
+
+	return res, true
+}
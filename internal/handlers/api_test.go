@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bookings/internal/apitoken"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/permission"
+)
+
+// apiReservationTests is the data for the APIReservation handler tests, /api/v1/reservations/{id}
+var apiReservationTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedErrorCode  string
+}{
+	{
+		name:               "found",
+		id:                 "1",
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "not-found",
+		id:                 "3",
+		expectedStatusCode: http.StatusNotFound,
+		expectedErrorCode:  apiNotFound,
+	},
+	{
+		name:               "malformed-id",
+		id:                 "fish",
+		expectedStatusCode: http.StatusNotFound,
+		expectedErrorCode:  apiNotFound,
+	},
+}
+
+// TestAPIReservation tests the APIReservation handler
+func TestAPIReservation(t *testing.T) {
+	for _, e := range apiReservationTests {
+		req, _ := http.NewRequest("GET", "/api/v1/reservations/"+e.id, nil)
+		req = withURLParams(req, map[string]string{"id": e.id})
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.APIReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		checkAPIError(t, e.name, rr, e.expectedErrorCode)
+	}
+}
+
+// apiCreateReservationTests is the data for the APICreateReservation handler tests, POST /api/v1/reservations
+var apiCreateReservationTests = []struct {
+	name               string
+	contentType        string
+	body               string
+	expectedStatusCode int
+	expectedErrorCode  string
+}{
+	{
+		name:               "valid",
+		contentType:        "application/json",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2040-01-01","end_date":"2040-01-02"}`,
+		expectedStatusCode: http.StatusCreated,
+	},
+	{
+		name:               "bad-json",
+		contentType:        "application/json",
+		body:               `{"room_id":1,`,
+		expectedStatusCode: http.StatusBadRequest,
+		expectedErrorCode:  apiBadRequest,
+	},
+	{
+		name:               "unknown-field",
+		contentType:        "application/json",
+		body:               `{"room_id":1,"nights":3}`,
+		expectedStatusCode: http.StatusBadRequest,
+		expectedErrorCode:  apiBadRequest,
+	},
+	{
+		name:               "invalid",
+		contentType:        "application/json",
+		body:               `{"room_id":1,"first_name":"J","last_name":"Smith","email":"john","start_date":"2040-01-01","end_date":"2040-01-02"}`,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedErrorCode:  apiInvalid,
+	},
+	{
+		name:               "json-with-charset",
+		contentType:        "application/json; charset=utf-8",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2040-01-01","end_date":"2040-01-02"}`,
+		expectedStatusCode: http.StatusCreated,
+	},
+	{
+		name:               "form-content-type",
+		contentType:        "application/x-www-form-urlencoded",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2040-01-01","end_date":"2040-01-02"}`,
+		expectedStatusCode: http.StatusUnsupportedMediaType,
+		expectedErrorCode:  apiMediaType,
+	},
+	{
+		name:               "missing-content-type",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2040-01-01","end_date":"2040-01-02"}`,
+		expectedStatusCode: http.StatusUnsupportedMediaType,
+		expectedErrorCode:  apiMediaType,
+	},
+	{
+		name:               "unavailable-dates",
+		contentType:        "application/json",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02"}`,
+		expectedStatusCode: http.StatusConflict,
+		expectedErrorCode:  apiUnavailable,
+	},
+}
+
+// TestAPICreateReservation tests the APICreateReservation handler
+func TestAPICreateReservation(t *testing.T) {
+	for _, e := range apiCreateReservationTests {
+		req, _ := http.NewRequest("POST", "/api/v1/reservations", strings.NewReader(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.APICreateReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		checkAPIError(t, e.name, rr, e.expectedErrorCode)
+	}
+}
+
+// apiCancelReservationTests is the data for the APICancelReservation handler tests, POST /api/v1/reservations/{id}/cancel
+var apiCancelReservationTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedErrorCode  string
+}{
+	{
+		name:               "cancel",
+		id:                 "1",
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "not-found",
+		id:                 "3",
+		expectedStatusCode: http.StatusNotFound,
+		expectedErrorCode:  apiNotFound,
+	},
+}
+
+// TestAPICancelReservation tests the APICancelReservation handler
+func TestAPICancelReservation(t *testing.T) {
+	for _, e := range apiCancelReservationTests {
+		req, _ := http.NewRequest("POST", "/api/v1/reservations/"+e.id+"/cancel", nil)
+		req = withURLParams(req, map[string]string{"id": e.id})
+		req = helpers.WithUser(req, models.User{ID: 1, Active: true, AccessLevel: permission.RoleFrontDesk})
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.APICancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		checkAPIError(t, e.name, rr, e.expectedErrorCode)
+
+		if rr.Code == http.StatusOK {
+			var envelope struct {
+				Data models.APIReservation `json:"data"`
+			}
+			_ = json.Unmarshal(rr.Body.Bytes(), &envelope)
+			if envelope.Data.Status != models.StatusCancelled {
+				t.Errorf("%s: expected status %s but got %s", e.name, models.StatusCancelled, envelope.Data.Status)
+			}
+		}
+	}
+}
+
+// requireAPITokenTests is the data for the RequireAPIToken middleware tests
+var requireAPITokenTests = []struct {
+	name               string
+	authorization      string
+	scope              string
+	expectedStatusCode int
+	expectedErrorCode  string
+}{
+	{
+		name:               "no-token",
+		authorization:      "",
+		scope:              models.ScopeRead,
+		expectedStatusCode: http.StatusUnauthorized,
+		expectedErrorCode:  apiUnauthorized,
+	},
+	{
+		name:               "not-bearer",
+		authorization:      "Basic " + apitoken.Prefix + "read",
+		scope:              models.ScopeRead,
+		expectedStatusCode: http.StatusUnauthorized,
+		expectedErrorCode:  apiUnauthorized,
+	},
+	{
+		name:               "unknown-token",
+		authorization:      "Bearer " + apitoken.Prefix + "unknown",
+		scope:              models.ScopeRead,
+		expectedStatusCode: http.StatusUnauthorized,
+		expectedErrorCode:  apiUnauthorized,
+	},
+	{
+		name:               "expired-token",
+		authorization:      "Bearer " + apitoken.Prefix + "expired",
+		scope:              models.ScopeRead,
+		expectedStatusCode: http.StatusUnauthorized,
+		expectedErrorCode:  apiUnauthorized,
+	},
+	{
+		name:               "read-token-reads",
+		authorization:      "Bearer " + apitoken.Prefix + "read",
+		scope:              models.ScopeRead,
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "read-token-writes",
+		authorization:      "Bearer " + apitoken.Prefix + "read",
+		scope:              models.ScopeWrite,
+		expectedStatusCode: http.StatusForbidden,
+		expectedErrorCode:  apiForbidden,
+	},
+	{
+		name:               "write-token-writes",
+		authorization:      "Bearer " + apitoken.Prefix + "write",
+		scope:              models.ScopeWrite,
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "user-without-permission",
+		authorization:      "Bearer " + apitoken.Prefix + "read-only-user",
+		scope:              models.ScopeWrite,
+		expectedStatusCode: http.StatusForbidden,
+		expectedErrorCode:  apiForbidden,
+	},
+}
+
+// TestRequireAPIToken tests the RequireAPIToken middleware in front of the cancel handler's permission
+func TestRequireAPIToken(t *testing.T) {
+	for _, e := range requireAPITokenTests {
+		req, _ := http.NewRequest("GET", "/api/v1/reservations/1", nil)
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+		rr := httptest.NewRecorder()
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the changes made with the token are made by its user
+			if _, ok := helpers.CurrentUser(r); !ok {
+				t.Errorf("%s: expected the user of the token in the request", e.name)
+			}
+			Repo.writeJSON(w, http.StatusOK, "ok")
+		})
+		handler := Repo.RequireAPIToken(e.scope, permission.EditReservations)(next)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		checkAPIError(t, e.name, rr, e.expectedErrorCode)
+
+		if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", e.name)
+		}
+	}
+}
+
+// checkAPIError checks that a response carries an error envelope with code, or none if code is ""
+func checkAPIError(t *testing.T, name string, rr *httptest.ResponseRecorder, code string) {
+	t.Helper()
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s: expected a JSON response but got content type %q", name, ct)
+	}
+
+	var envelope models.APIError
+	err := json.Unmarshal(rr.Body.Bytes(), &envelope)
+	if err != nil {
+		t.Errorf("%s: failed to parse json: %s", name, err)
+		return
+	}
+
+	if envelope.Error.Code != code {
+		t.Errorf("%s: expected error code %q but got %q", name, code, envelope.Error.Code)
+	}
+	if code != "" && envelope.Error.Message == "" {
+		t.Errorf("%s: expected an error message", name)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"bookings/internal/repository"
+	"net/http"
+	"strconv"
+)
+
+// auditEventsShown is how many audit events the audit page shows at most
+const auditEventsShown = 200
+
+// auditDB returns the repository to make changes through, so they are recorded in the audit log
+// with the logged in user, or the owner of the API token, and their IP address
+func (m *Repository) auditDB(r *http.Request) repository.DatabaseRepo {
+	user, _ := helpers.CurrentUser(r)
+	return m.DB.WithActor(models.AuditActor{
+		UserID:    user.ID,
+		IPAddress: helpers.ClientIP(r),
+	})
+}
+
+// AdminAudit lists the latest changes made in the admin area, filtered by the query parameters
+func (m *Repository) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var filter models.AuditFilter
+	filter.UserID, _ = strconv.Atoi(query.Get("user"))
+	filter.Action = query.Get("action")
+	filter.Entity = query.Get("entity")
+	filter.EntityID, _ = strconv.Atoi(query.Get("entity_id"))
+	if from, err := helpers.ConvertStringToDate(query.Get("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := helpers.ConvertStringToDate(query.Get("to")); err == nil {
+		// the to date is included
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	events, err := m.DB.AuditEvents(filter, auditEventsShown)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	users, err := m.DB.AllUsers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	for _, key := range []string{"user", "action", "entity", "entity_id", "from", "to"} {
+		stringMap[key] = query.Get(key)
+	}
+
+	data := make(map[string]interface{})
+	data["events"] = events
+	data["users"] = users
+	data["actions"] = models.AuditActions
+	data["entities"] = models.AuditEntities
+
+	render.Template(w, r, "admin-audit.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
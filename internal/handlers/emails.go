@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bookings/internal/ical"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// newEmail renders the named email template into a message to the given address
+func (m *Repository) newEmail(to, tmpl string, ed *models.EmailData) (models.MailData, error) {
+	htmlBody, textBody, err := render.Email(tmpl, ed)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	return models.MailData{
+		To:        to,
+		From:      m.App.MailFrom,
+		Subject:   ed.Subject,
+		Content:   htmlBody,
+		PlainText: textBody,
+	}, nil
+}
+
+// reservationEmail renders an email about a reservation to its guest. Unless method is empty, the
+// stay is attached as a calendar event with that iCalendar method.
+func (m *Repository) reservationEmail(tmpl, subject, method string, res models.Reservation) (models.MailData, error) {
+	stringMap := make(map[string]string)
+	stringMap["link"] = m.bookingLink(res)
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	msg, err := m.newEmail(res.Email, tmpl, &models.EmailData{
+		Subject:   subject,
+		StringMap: stringMap,
+		Data:      data,
+	})
+	if err != nil {
+		return msg, err
+	}
+
+	if method != "" {
+		msg.Attachments = append(msg.Attachments, m.stayInvitation(res, method))
+	}
+
+	return msg, nil
+}
+
+// confirmationEmail builds the booking confirmation sent to the guest
+func (m *Repository) confirmationEmail(res models.Reservation) (models.MailData, error) {
+	return m.reservationEmail("confirmation", "Reservation Confirmation", ical.MethodRequest, res)
+}
+
+// updateEmail builds the notice sent to the guest when a booking has been changed
+func (m *Repository) updateEmail(res models.Reservation) (models.MailData, error) {
+	return m.reservationEmail("update", "Reservation Updated", ical.MethodRequest, res)
+}
+
+// cancellationEmail builds the notice sent to the guest when a booking is cancelled
+func (m *Repository) cancellationEmail(res models.Reservation) (models.MailData, error) {
+	return m.reservationEmail("cancellation", "Reservation Cancelled", ical.MethodCancel, res)
+}
+
+// reminderEmail builds the reminder sent to the guest before arrival
+func (m *Repository) reminderEmail(res models.Reservation) (models.MailData, error) {
+	return m.reservationEmail("reminder", "Your Upcoming Stay", "", res)
+}
+
+// stayInvitation builds the invite.ics attachment for a stay, running from check-in on the
+// arrival date to check-out on the departure date
+func (m *Repository) stayInvitation(res models.Reservation, method string) models.Attachment {
+	p := m.App.Property
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	atTime := func(day time.Time, offset time.Duration) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc).Add(offset)
+	}
+
+	host := "bookings"
+	if u, err := url.Parse(m.App.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	cal := ical.Calendar{
+		ProdID: "-//Bookings//Reservations//EN",
+		Method: method,
+		Events: []ical.Event{
+			{
+				UID:      fmt.Sprintf("reservation-%d@%s", res.ID, host),
+				Sequence: res.Sequence,
+				Summary:  fmt.Sprintf("%s: %s", p.Name, res.Room.RoomName),
+				Description: fmt.Sprintf("Reservation %d for %s %s\nManage your booking: %s",
+					res.ID, res.FirstName, res.LastName, m.bookingLink(res)),
+				Location:  p.Address,
+				Start:     atTime(res.StartDate, p.CheckIn),
+				End:       atTime(res.EndDate, p.CheckOut),
+				Cancelled: method == ical.MethodCancel,
+				Organizer: m.App.MailFrom,
+				Attendee:  res.Email,
+			},
+		},
+	}
+
+	return models.Attachment{
+		Name:        "invite.ics",
+		ContentType: fmt.Sprintf("%s; method=%s", ical.ContentType, method),
+		Data:        cal.Bytes(),
+	}
+}
+
+// sendEmail writes a message built by one of the email functions to the outbox, logging errors
+// since the action that triggered the email has already succeeded
+func (m *Repository) sendEmail(msg models.MailData, err error) {
+	if err != nil {
+		m.App.ErrorLog.Println("cannot build email:", err)
+		return
+	}
+
+	err = m.DB.QueueEmail(msg)
+	if err != nil {
+		m.App.ErrorLog.Printf("cannot queue email to %s: %v", msg.To, err)
+	}
+}
+
+// notifyAdmin emails the admin address about something a guest did
+func (m *Repository) notifyAdmin(subject, message string) {
+	stringMap := make(map[string]string)
+	stringMap["message"] = message
+
+	m.sendEmail(m.newEmail(m.App.AdminEmail, "admin-notice", &models.EmailData{
+		Subject:   subject,
+		StringMap: stringMap,
+	}))
+}
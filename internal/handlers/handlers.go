@@ -5,15 +5,21 @@ import (
 	"bookings/internal/driver"
 	"bookings/internal/forms"
 	"bookings/internal/helpers"
+	"bookings/internal/icalsync"
 	"bookings/internal/models"
+	"bookings/internal/pricing"
 	"bookings/internal/render"
 	"bookings/internal/repository"
 	"bookings/internal/repository/dbrepo"
+	"bookings/internal/stayrules"
+	"bookings/internal/webhooks"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,23 +35,37 @@ var Repo *Repository
 
 // Repository is the repository type
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App       *config.AppConfig
+	DB        repository.DatabaseRepo
+	Pricing   *pricing.Engine
+	StayRules *stayrules.Checker
+	ICalSync  *icalsync.Syncer
+	Webhooks  *webhooks.Dispatcher
 }
 
 // NewRepo creates a new repository
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
+	dbRepo := dbrepo.NewPostgresRepo(db.SQL, a)
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+		App:       a,
+		DB:        dbRepo,
+		Pricing:   pricing.NewEngine(dbRepo),
+		StayRules: stayrules.NewChecker(dbRepo),
+		ICalSync:  icalsync.NewSyncer(dbRepo, a.ErrorLog),
+		Webhooks:  webhooks.NewDispatcher(dbRepo, a.ErrorLog),
 	}
 }
 
 // NewRepo creates a new repository
 func NewTestRepo(a *config.AppConfig) *Repository {
+	dbRepo := dbrepo.NewTestingsRepo(a)
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewTestingsRepo(a),
+		App:       a,
+		DB:        dbRepo,
+		Pricing:   pricing.NewEngine(dbRepo),
+		StayRules: stayrules.NewChecker(dbRepo),
+		ICalSync:  icalsync.NewSyncer(dbRepo, a.ErrorLog),
+		Webhooks:  webhooks.NewDispatcher(dbRepo, a.ErrorLog),
 	}
 }
 
@@ -54,6 +74,18 @@ func NewHandlers(r *Repository) {
 	Repo = r
 }
 
+// stayRuleViolation returns the reason a stay breaks one of the room's stay rules, or "" if it breaks none
+func (m *Repository) stayRuleViolation(roomID int, start, end time.Time) (string, error) {
+	err := m.StayRules.CheckStay(roomID, start, end)
+
+	var violation *stayrules.Violation
+	if errors.As(err, &violation) {
+		return violation.Reason, nil
+	}
+
+	return "", err
+}
+
 // Home is the handler for the home page
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
@@ -82,6 +114,16 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	reservation.Room.RoomName = room.RoomName
 
+	quote, err := m.Pricing.QuoteStay(reservation.RoomID, reservation.StartDate, reservation.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot price the stay")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	reservation.TotalPrice = quote.Total
+	reservation.PriceLines = quote.Lines
+
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 
 	stringMap := make(map[string]string)
@@ -133,52 +175,84 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	reason, err := m.stayRuleViolation(reservation.RoomID, reservation.StartDate, reservation.EndDate)
 	if err != nil {
 		helpers.ServerError(w, err)
+		return
 	}
-
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	if reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	// rates may have changed since the form was shown, so price the stay again
+	quote, err := m.Pricing.QuoteStay(reservation.RoomID, reservation.StartDate, reservation.EndDate)
 	if err != nil {
 		helpers.ServerError(w, err)
+		return
 	}
 
-	// send notifications
-	htmlMessage := fmt.Sprintf(`
-		<p><strong>Reservation Confirmation</strong><br/></p>
-		<p>Dear %s, <br/> This is a confirmation of your booking from %s to %s.</p>
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
-
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "me@here.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "basic.html",
+	reservation.TotalPrice = quote.Total
+	reservation.PriceLines = quote.Lines
+
+	// the confirmation is queued in the outbox together with the booking, so it is sent even if
+	// the mail server is down right now
+	newReservationID, err := m.DB.CreateBooking(reservation, func(id int) (models.MailData, error) {
+		booked := reservation
+		booked.ID = id
+		return m.confirmationEmail(booked)
+	}, reservationEvent(models.EventReservationCreated))
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.App.Session.Remove(r.Context(), "reservation")
+		m.App.Session.Put(r.Context(), "error", "Sorry, that room was just taken for those dates. Please search again.")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
 
-	m.App.MailChan <- msg
+	reservation.ID = newReservationID
+	reservation.Status = models.StatusPending
 
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
 
-// Generals renders the room page
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
+// Rooms renders the list of all rooms
+func (m *Repository) Rooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
-// Majors renders the room page
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+// Room renders the detail page of a room looked up by its slug
+func (m *Repository) Room(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomBySlug(chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.Template(w, r, "room.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
 // Availability renders the search availability page
@@ -202,15 +276,34 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	freeRooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	// only offer the free rooms whose stay rules allow these dates
+	var rooms []models.Room
+	var reason string
+	for _, room := range freeRooms {
+		violation, err := m.stayRuleViolation(room.ID, startDate, endDate)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if violation != "" {
+			reason = violation
+			continue
+		}
+		rooms = append(rooms, room)
+	}
+
 	if len(rooms) == 0 {
 		// No availability
-		m.App.Session.Put(r.Context(), "error", "No availability")
+		if reason == "" {
+			reason = "No availability"
+		}
+		m.App.Session.Put(r.Context(), "error", reason)
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
@@ -240,7 +333,7 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, errors.New("cannot get reservation from session"))
 		return
 	}
 
@@ -276,6 +369,17 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reason, err := m.stayRuleViolation(roomID, startDate, endDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	var reservation models.Reservation
 
 	reservation.RoomID = roomID
@@ -322,6 +426,16 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	var message string
 	if isRoomAvailable {
 		message = "Available!"
+
+		reason, err := m.stayRuleViolation(roomId, startDate, endDate)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if reason != "" {
+			isRoomAvailable = false
+			message = reason
+		}
 	} else {
 		message = "Not Available!"
 	}
@@ -404,21 +518,55 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if m.loginThrottled(w, r, email) {
+		return
+	}
+
 	id, _, err := m.DB.Authenticate(email, password)
 	if err != nil {
 		log.Println(err)
+		m.recordLoginFailure(r, email, models.LoginFailurePassword)
 		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
 		http.Redirect(w, r, "/users/login", http.StatusSeeOther)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
+	user, err := m.DB.GetUserByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if user.TwoFactorEnabled() {
+		trusted, err := m.isTrustedDevice(r, user)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !trusted {
+			m.App.Session.Put(r.Context(), "two_factor_user_id", id)
+			m.App.Session.Put(r.Context(), "two_factor_started", time.Now().Unix())
+			http.Redirect(w, r, "/users/login/two-factor", http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = m.logIn(r, user)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 // PostLogin logs a user out
 func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	err := m.DB.DeleteUserSessionByToken(m.App.Session.Token(r.Context()))
+	if err != nil {
+		m.App.ErrorLog.Println("cannot remove user session:", err)
+	}
+
 	_ = m.App.Session.Destroy(r.Context())
 	_ = m.App.Session.RenewToken(r.Context())
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -446,9 +594,18 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// AdminAllReservations shows all reservation in admin dashboard page
+// AdminAllReservations shows all reservation in admin dashboard page, optionally filtered by status
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+	status := r.URL.Query().Get("status")
+
+	var reservations []models.Reservation
+	var err error
+	if models.IsReservationStatus(status) {
+		reservations, err = m.DB.ReservationsByStatus(status)
+	} else {
+		status = ""
+		reservations, err = m.DB.AllReservations()
+	}
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -456,9 +613,14 @@ func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["statuses"] = models.ReservationStatuses
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
 
 	render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
+		Data:      data,
+		StringMap: stringMap,
 	})
 }
 
@@ -515,12 +677,14 @@ func (m *Repository) AdminUpdateReservation(w http.ResponseWriter, r *http.Reque
 	reservation.LastName = r.Form.Get("last_name")
 	reservation.Email = r.Form.Get("email")
 	reservation.Phone = r.Form.Get("phone")
+	reservation.TotalPrice, _ = pricing.ParseAmount(r.Form.Get("total_price"))
 
 	form := forms.New(r.PostForm)
 
-	form.Required("first_name", "last_name", "email")
+	form.Required("first_name", "last_name", "email", "total_price")
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
+	form.IsMoney("total_price")
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
@@ -531,17 +695,20 @@ func (m *Repository) AdminUpdateReservation(w http.ResponseWriter, r *http.Reque
 		})
 		return
 	}
-	err = m.DB.UpdateReservation(reservation)
+	err = m.auditDB(r).UpdateReservation(reservation, reservationEvent(models.EventReservationUpdated))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	reservation.Sequence++
+	m.sendEmail(m.updateEmail(reservation))
+
 	m.App.Session.Put(r.Context(), "flash", "Changes saved")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s", chi.URLParam(r, "src")), http.StatusSeeOther)
 }
 
-// AdminProcessReservation marks a reservation as processed
+// AdminProcessReservation moves a reservation to the posted status
 func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
 	resID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -549,19 +716,42 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	processed, err := strconv.Atoi(r.URL.Query().Get("processed"))
+	err = r.ParseForm()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	err = m.DB.UpdateProcessedForReservation(resID, processed)
-	if err != nil {
+	src := chi.URLParam(r, "src")
+	status := r.Form.Get("status")
+
+	event := models.EventReservationProcessed
+	if status == models.StatusCancelled {
+		event = models.EventReservationCancelled
+	}
+
+	err = m.auditDB(r).UpdateReservationStatus(resID, status, reservationEvent(event))
+	if errors.Is(err, repository.ErrInvalidStatusTransition) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation cannot be moved to %s", status))
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, resID), http.StatusSeeOther)
+		return
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s", chi.URLParam(r, "src")), http.StatusSeeOther)
+	if status == models.StatusCancelled {
+		res, err := m.DB.GetReservationByID(resID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		m.sendEmail(m.cancellationEmail(res))
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation is now %s", status))
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s", src), http.StatusSeeOther)
 }
 
 // AdminDeleteReservation deletes a reservation by id
@@ -572,12 +762,24 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = m.DB.DeleteReservation(resID)
+	res, err := m.DB.GetReservationByID(resID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.auditDB(r).DeleteReservation(resID, reservationEvent(models.EventReservationDeleted))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	// guests whose stay is still ahead get the event removed from their calendar
+	if res.Status == models.StatusPending || res.Status == models.StatusConfirmed {
+		res.Sequence++
+		m.sendEmail(m.cancellationEmail(res))
+	}
+
 	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s", chi.URLParam(r, "src")), http.StatusSeeOther)
 }
@@ -631,11 +833,14 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	}
 
 	data["rooms"] = rooms
+	data["statuses"] = models.ReservationStatuses
 
 	for _, room := range rooms {
 		// create maps
 		reservationMap := make(map[string]int)
+		statusMap := make(map[string]string)
 		blockMap := make(map[string]int)
+		externalMap := make(map[string]int)
 
 		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
 			reservationMap[d.Format(DateFormat)] = 0
@@ -654,6 +859,12 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 				// it's a reservation
 				for d := restr.StartDate; !d.After(restr.EndDate); d = d.AddDate(0, 0, 1) {
 					reservationMap[d.Format(DateFormat)] = restr.ReservationID
+					statusMap[d.Format(DateFormat)] = restr.Reservation.Status
+				}
+			} else if restr.RestrictionID == icalsync.RestrictionExternal {
+				// it's imported from another calendar and cannot be edited here
+				for d := restr.StartDate; d.Before(restr.EndDate); d = d.AddDate(0, 0, 1) {
+					externalMap[d.Format(DateFormat)] = 1
 				}
 			} else {
 				// it's a block (restriction)
@@ -665,6 +876,8 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		block_map_key := fmt.Sprintf("block_map_%d", room.ID)
 
 		data[reservation_map_key] = reservationMap
+		data[fmt.Sprintf("status_map_%d", room.ID)] = statusMap
+		data[fmt.Sprintf("external_map_%d", room.ID)] = externalMap
 		data[block_map_key] = blockMap
 
 		m.App.Session.Put(r.Context(), block_map_key, blockMap)
@@ -696,6 +909,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	}
 
 	form := forms.New(r.PostForm)
+	db := m.auditDB(r)
 
 	for _, room := range rooms {
 		// Get the block map from the session.
@@ -711,9 +925,10 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 				if val > 0 {
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, name)) {
 						// delete the restriction by id
-						err := m.DB.DeleteRoomRestrictionByID(value)
+						err := db.DeleteRoomRestrictionByID(value)
 						if err != nil {
-							log.Println(err)
+							helpers.ServerError(w, err)
+							return
 						}
 					}
 				}
@@ -721,20 +936,477 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 		}
 	}
 
-	// handle new blocks
+	// handle new blocks, remembering the nights that were taken in the meantime
+	var taken []string
 	for name, _ := range r.PostForm {
 		if strings.HasPrefix(name, "add_block") {
 			exploded := strings.Split(name, "_")
 			roomID, _ := strconv.Atoi(exploded[2])
 			// insert a new block
 			t, _ := helpers.ConvertStringToDate(exploded[3])
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			err := db.InsertBlockForRoom(roomID, t)
+			if errors.Is(err, repository.ErrRoomNotAvailable) {
+				taken = append(taken, t.Format("2006-01-02"))
+				continue
+			}
 			if err != nil {
-				log.Println(err)
+				helpers.ServerError(w, err)
+				return
 			}
 		}
 	}
 
+	if len(taken) > 0 {
+		sort.Strings(taken)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Could not block %s: already reserved or blocked", strings.Join(taken, ", ")))
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "flash", "Changes saved")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 }
+
+// AdminRooms shows all rooms in admin dashboard page
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowRoom renders the room form, an id of 0 means a new room
+func (m *Repository) AdminShowRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room := models.Room{Capacity: 2}
+	if roomID > 0 {
+		room, err = m.DB.GetRoomByID(roomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	stringMap := make(map[string]string)
+	if roomID > 0 {
+		token, err := m.DB.GetRoomICalToken(roomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if token != "" {
+			stringMap["feed_link"] = m.roomFeedLink(roomID, token)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.Template(w, r, "admin-room.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostRoom inserts a new room or updates an existing one
+func (m *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var room models.Room
+	if roomID > 0 {
+		room, err = m.DB.GetRoomByID(roomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	room.RoomName = r.Form.Get("room_name")
+	room.Slug = r.Form.Get("slug")
+	room.Description = r.Form.Get("description")
+	room.Images = helpers.SplitLines(r.Form.Get("images"))
+	room.Capacity, _ = strconv.Atoi(r.Form.Get("capacity"))
+	room.Amenities = helpers.SplitLines(r.Form.Get("amenities"))
+	room.NightlyRate, _ = pricing.ParseAmount(r.Form.Get("nightly_rate"))
+	room.WeekendUplift, _ = strconv.Atoi(r.Form.Get("weekend_uplift"))
+
+	form := forms.New(r.PostForm)
+	form.Required("room_name", "slug", "capacity", "nightly_rate", "weekend_uplift")
+	form.MinLength("room_name", 3)
+	form.IsSlug("slug")
+	form.IsInt("capacity", 1)
+	form.IsMoney("nightly_rate")
+	form.IsInt("weekend_uplift", 0)
+
+	existing, err := m.DB.GetRoomBySlug(room.Slug)
+	if err == nil && existing.ID != room.ID {
+		form.Errors.Add("slug", "This slug is already used by another room")
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["room"] = room
+		render.Template(w, r, "admin-room.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	if roomID > 0 {
+		err = m.auditDB(r).UpdateRoom(room)
+	} else {
+		_, err = m.auditDB(r).InsertRoom(room)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminDeleteRoom deletes a room by id
+func (m *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.auditDB(r).DeleteRoom(roomID)
+	if errors.Is(err, repository.ErrRoomInUse) {
+		m.App.Session.Put(r.Context(), "error", "Room has reservations or upcoming blocks and cannot be deleted")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminRoomRates shows the seasonal rates of a room with a form to add a new one
+func (m *Repository) AdminRoomRates(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	seasons, err := m.DB.GetSeasonalRatesForRoom(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["seasons"] = seasons
+
+	render.Template(w, r, "admin-room-rates.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostRoomRate adds a seasonal rate to a room
+func (m *Repository) AdminPostRoomRate(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "start_date", "end_date", "nightly_rate")
+	form.IsMoney("nightly_rate")
+
+	startDate, err := helpers.ConvertStringToDate(r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+	endDate, err := helpers.ConvertStringToDate(r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Invalid date")
+	} else if endDate.Before(startDate) {
+		form.Errors.Add("end_date", "The season cannot end before it starts")
+	}
+
+	if !form.Valid() {
+		room, err := m.DB.GetRoomByID(roomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		seasons, err := m.DB.GetSeasonalRatesForRoom(roomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := make(map[string]interface{})
+		data["room"] = room
+		data["seasons"] = seasons
+
+		render.Template(w, r, "admin-room-rates.page.tmpl", &models.TemplateData{
+			Data: data,
+			Form: form,
+		})
+		return
+	}
+
+	nightlyRate, _ := pricing.ParseAmount(r.Form.Get("nightly_rate"))
+
+	err = m.auditDB(r).InsertSeasonalRate(models.SeasonalRate{
+		RoomID:      roomID,
+		Name:        r.Form.Get("name"),
+		StartDate:   startDate,
+		EndDate:     endDate,
+		NightlyRate: nightlyRate,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Seasonal rate added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rates", roomID), http.StatusSeeOther)
+}
+
+// AdminDeleteRoomRate deletes a seasonal rate of a room
+func (m *Repository) AdminDeleteRoomRate(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rateID, err := strconv.Atoi(chi.URLParam(r, "rateID"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.auditDB(r).DeleteSeasonalRate(roomID, rateID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Seasonal rate deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rates", roomID), http.StatusSeeOther)
+}
+
+// AdminStayRules shows all stay rules with a form to add a new one
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	m.renderStayRules(w, r, forms.New(nil))
+}
+
+// renderStayRules renders the stay rules page with the given add rule form
+func (m *Repository) renderStayRules(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var weekdays []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays = append(weekdays, d)
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = rules
+	data["rooms"] = rooms
+	data["weekdays"] = weekdays
+
+	render.Template(w, r, "admin-stay-rules.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostStayRule adds a stay rule
+func (m *Repository) AdminPostStayRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "start_date", "end_date")
+
+	var rule models.StayRule
+	rule.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	rule.MinNights, _ = strconv.Atoi(r.Form.Get("min_nights"))
+	rule.MaxNights, _ = strconv.Atoi(r.Form.Get("max_nights"))
+
+	for _, field := range []string{"min_nights", "max_nights"} {
+		if form.Has(field) {
+			form.IsInt(field, 0)
+		}
+	}
+
+	rule.StartDate, err = helpers.ConvertStringToDate(r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+	rule.EndDate, err = helpers.ConvertStringToDate(r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Invalid date")
+	} else if rule.EndDate.Before(rule.StartDate) {
+		form.Errors.Add("end_date", "The rule cannot end before it starts")
+	}
+
+	if rule.MinNights > 0 && rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "Maximum nights cannot be less than minimum nights")
+	}
+
+	for _, v := range r.Form["closed_to_arrival"] {
+		d, _ := strconv.Atoi(v)
+		rule.ClosedToArrival = append(rule.ClosedToArrival, time.Weekday(d))
+	}
+	for _, v := range r.Form["closed_to_departure"] {
+		d, _ := strconv.Atoi(v)
+		rule.ClosedToDeparture = append(rule.ClosedToDeparture, time.Weekday(d))
+	}
+
+	if !form.Valid() {
+		m.renderStayRules(w, r, form)
+		return
+	}
+
+	err = m.auditDB(r).InsertStayRule(rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule added")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// AdminDeleteStayRule deletes a stay rule by id
+func (m *Repository) AdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.auditDB(r).DeleteStayRule(ruleID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule deleted")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// AdminFailedEmails lists the emails that could not be delivered
+func (m *Repository) AdminFailedEmails(w http.ResponseWriter, r *http.Request) {
+	emails, err := m.DB.FailedEmails()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["emails"] = emails
+
+	render.Template(w, r, "admin-failed-emails.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminResendEmail queues a failed email for delivery again
+func (m *Repository) AdminResendEmail(w http.ResponseWriter, r *http.Request) {
+	emailID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ResendEmail(emailID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Email queued for delivery")
+	http.Redirect(w, r, "/admin/emails/failed", http.StatusSeeOther)
+}
+
+// AdminRemindReservation emails the guest a reminder of their upcoming stay
+func (m *Repository) AdminRemindReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.sendEmail(m.reminderEmail(res))
+
+	m.App.Session.Put(r.Context(), "flash", "Reminder sent")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, id), http.StatusSeeOther)
+}
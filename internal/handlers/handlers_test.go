@@ -13,8 +13,10 @@ import (
 	"testing"
 	"time"
 
-	"github.com/tsawler/bookings/internal/driver"
-	"github.com/tsawler/bookings/internal/models"
+	"bookings/internal/driver"
+	"bookings/internal/models"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type postData struct {
@@ -30,19 +32,19 @@ var theTests = []struct {
 }{
 	{"home", "/", "GET", http.StatusOK},
 	{"about", "/about", "GET", http.StatusOK},
-	{"gq", "/generals-quarters", "GET", http.StatusOK},
-	{"ms", "/majors-suite", "GET", http.StatusOK},
+	{"rooms", "/rooms", "GET", http.StatusOK},
+	{"gq", "/rooms/generals-quarters", "GET", http.StatusOK},
 	{"sa", "/search-availability", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
 	{"non-existent", "/green/eggs/and/ham", "GET", http.StatusNotFound},
-	{"login", "/user/login", "GET", http.StatusOK},
-	{"logout", "/user/logout", "GET", http.StatusOK},
+	{"login", "/users/login", "GET", http.StatusOK},
+	{"logout", "/users/logout", "GET", http.StatusOK},
 	{"dashboard", "/admin/dashboard", "GET", http.StatusOK},
-	{"new res", "/admin/reservations-new", "GET", http.StatusOK},
-	{"all res", "/admin/reservations-all", "GET", http.StatusOK},
-	{"show res", "/admin/reservations/new/1/show", "GET", http.StatusOK},
-	{"show res cal", "/admin/reservations-calendar", "GET", http.StatusOK},
-	{"show res cal with params", "/admin/reservations-calendar?y=2020&m=1", "GET", http.StatusOK},
+	{"new res", "/admin/reservations/new", "GET", http.StatusOK},
+	{"all res", "/admin/reservations/all", "GET", http.StatusOK},
+	{"show res", "/admin/reservations/new/1", "GET", http.StatusOK},
+	{"show res cal", "/admin/reservations/calendar", "GET", http.StatusOK},
+	{"show res cal with params", "/admin/reservations/calendar?y=2020&m=1", "GET", http.StatusOK},
 }
 
 // TestHandlers tests all routes that don't require extra tests (gets)
@@ -75,7 +77,9 @@ var reservationTests = []struct {
 	{
 		name: "reservation-in-session",
 		reservation: models.Reservation{
-			RoomID: 1,
+			RoomID:    1,
+			StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC),
 			Room: models.Room{
 				ID:       1,
 				RoomName: "General's Quarters",
@@ -87,20 +91,22 @@ var reservationTests = []struct {
 	{
 		name:               "reservation-not-in-session",
 		reservation:        models.Reservation{},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 		expectedLocation:   "/",
 		expectedHTML:       "",
 	},
 	{
 		name: "non-existent-room",
 		reservation: models.Reservation{
-			RoomID: 100,
+			RoomID:    100,
+			StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC),
 			Room: models.Room{
 				ID:       100,
 				RoomName: "General's Quarters",
 			},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 		expectedLocation:   "/",
 		expectedHTML:       "",
 	},
@@ -126,10 +132,8 @@ func TestReservation(t *testing.T) {
 		}
 
 		if e.expectedLocation != "" {
-			// get the URL from test
-			actualLoc, _ := rr.Result().Location()
-			if actualLoc.String() != e.expectedLocation {
-				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
 			}
 		}
 
@@ -143,9 +147,10 @@ func TestReservation(t *testing.T) {
 	}
 }
 
-// postReservationTests is the test data for hte PostReservation handler test
+// postReservationTests is the test data for the PostReservation handler test
 var postReservationTests = []struct {
 	name                 string
+	reservation          models.Reservation
 	postedData           url.Values
 	expectedResponseCode int
 	expectedLocation     string
@@ -153,132 +158,82 @@ var postReservationTests = []struct {
 }{
 	{
 		name: "valid-data",
-		postedData: url.Values{
-			"start_date": {"2050-01-01"},
-			"end_date":   {"2050-01-02"},
-			"first_name": {"John"},
-			"last_name":  {"Smith"},
-			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
-			"room_id":    {"1"},
-		},
-		expectedResponseCode: http.StatusSeeOther,
-		expectedHTML:         "",
-		expectedLocation:     "/reservation-summary",
-	},
-	{
-		name:                 "missing-post-body",
-		postedData:           nil,
-		expectedResponseCode: http.StatusSeeOther,
-		expectedHTML:         "",
-		expectedLocation:     "/",
-	},
-	{
-		name: "invalid-start-date",
-		postedData: url.Values{
-			"start_date": {"invalid"},
-			"end_date":   {"2050-01-02"},
-			"first_name": {"John"},
-			"last_name":  {"Smith"},
-			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
-			"room_id":    {"1"},
+		reservation: models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC),
 		},
-		expectedResponseCode: http.StatusSeeOther,
-		expectedHTML:         "",
-		expectedLocation:     "/",
-	},
-	{
-		name: "invalid-end-date",
 		postedData: url.Values{
-			"start_date": {"2050-01-01"},
-			"end_date":   {"end"},
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
-			"room_id":    {"1"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
 		expectedHTML:         "",
-		expectedLocation:     "/",
+		expectedLocation:     "/reservation-summary",
 	},
 	{
-		name: "invalid-room-id",
+		name:        "reservation-not-in-session",
+		reservation: models.Reservation{},
 		postedData: url.Values{
-			"start_date": {"2050-01-01"},
-			"end_date":   {"2050-01-02"},
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
-			"room_id":    {"invalid"},
 		},
-		expectedResponseCode: http.StatusSeeOther,
+		expectedResponseCode: http.StatusInternalServerError,
 		expectedHTML:         "",
-		expectedLocation:     "/",
+		expectedLocation:     "",
 	},
 	{
 		name: "invalid-data",
+		reservation: models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
 		postedData: url.Values{
-			"start_date": {"2050-01-01"},
-			"end_date":   {"2050-01-02"},
 			"first_name": {"J"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
-			"room_id":    {"1"},
 		},
 		expectedResponseCode: http.StatusOK,
 		expectedHTML:         `action="/make-reservation"`,
 		expectedLocation:     "",
 	},
 	{
-		name: "database-insert-fails-reservation",
-		postedData: url.Values{
-			"start_date": {"2050-01-01"},
-			"end_date":   {"2050-01-02"},
-			"first_name": {"John"},
-			"last_name":  {"Smith"},
-			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
-			"room_id":    {"2"},
+		name: "room-taken",
+		reservation: models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
 		},
-		expectedResponseCode: http.StatusSeeOther,
-		expectedHTML:         "",
-		expectedLocation:     "/",
-	},
-	{
-		name: "database-insert-fails-restriction",
 		postedData: url.Values{
-			"start_date": {"2050-01-01"},
-			"end_date":   {"2050-01-02"},
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
-			"room_id":    {"1000"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
 		expectedHTML:         "",
-		expectedLocation:     "/",
+		expectedLocation:     "/search-availability",
 	},
 }
 
 // TestPostReservation tests the PostReservation handler
 func TestPostReservation(t *testing.T) {
 	for _, e := range postReservationTests {
-		var req *http.Request
-		if e.postedData != nil {
-			req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(e.postedData.Encode()))
-		} else {
-			req, _ = http.NewRequest("POST", "/make-reservation", nil)
-
-		}
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(e.postedData.Encode()))
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
+		if e.reservation.RoomID > 0 {
+			session.Put(ctx, "reservation", e.reservation)
+		}
+
 		rr := httptest.NewRecorder()
 
 		handler := http.HandlerFunc(Repo.PostReservation)
@@ -290,10 +245,8 @@ func TestPostReservation(t *testing.T) {
 		}
 
 		if e.expectedLocation != "" {
-			// get the URL from test
-			actualLoc, _ := rr.Result().Location()
-			if actualLoc.String() != e.expectedLocation {
-				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
 			}
 		}
 
@@ -319,10 +272,10 @@ func TestNewRepo(t *testing.T) {
 
 // testAvailabilityJSONData is data for the AvailabilityJSON handler, /search-availability-json route
 var testAvailabilityJSONData = []struct {
-	name            string
-	postedData      url.Values
-	expectedOK      bool
-	expectedMessage string
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedOK         bool
 }{
 	{
 		name: "rooms not available",
@@ -331,7 +284,8 @@ var testAvailabilityJSONData = []struct {
 			"end":     {"2050-01-02"},
 			"room_id": {"1"},
 		},
-		expectedOK: false,
+		expectedStatusCode: http.StatusOK,
+		expectedOK:         false,
 	}, {
 		name: "rooms are available",
 		postedData: url.Values{
@@ -339,13 +293,13 @@ var testAvailabilityJSONData = []struct {
 			"end":     {"2040-01-02"},
 			"room_id": {"1"},
 		},
-		expectedOK: true,
+		expectedStatusCode: http.StatusOK,
+		expectedOK:         true,
 	},
 	{
-		name:            "empty post body",
-		postedData:      nil,
-		expectedOK:      false,
-		expectedMessage: "Internal Server Error",
+		name:               "empty post body",
+		postedData:         url.Values{},
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 	{
 		name: "database query fails",
@@ -354,8 +308,7 @@ var testAvailabilityJSONData = []struct {
 			"end":     {"2060-01-02"},
 			"room_id": {"1"},
 		},
-		expectedOK:      false,
-		expectedMessage: "Error querying database",
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 }
 
@@ -363,21 +316,25 @@ var testAvailabilityJSONData = []struct {
 func TestAvailabilityJSON(t *testing.T) {
 	for _, e := range testAvailabilityJSONData {
 		// create request, get the context with session, set header, create recorder
-		var req *http.Request
-		if e.postedData != nil {
-			req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(e.postedData.Encode()))
-		} else {
-			req, _ = http.NewRequest("POST", "/search-availability-json", nil)
-		}
+		req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(e.postedData.Encode()))
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_ = req.ParseForm()
 		rr := httptest.NewRecorder()
 
 		// make our handler a http.HandlerFunc and call
 		handler := http.HandlerFunc(Repo.AvailabilityJSON)
 		handler.ServeHTTP(rr, req)
 
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s gave wrong status code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
 		var j jsonResponse
 		err := json.Unmarshal([]byte(rr.Body.String()), &j)
 		if err != nil {
@@ -404,29 +361,28 @@ var testPostAvailabilityData = []struct {
 			"end":   {"2050-01-02"},
 		},
 		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
 	},
 	{
 		name: "rooms are available",
 		postedData: url.Values{
-			"start":   {"2040-01-01"},
-			"end":     {"2040-01-02"},
-			"room_id": {"1"},
+			"start": {"2040-01-01"},
+			"end":   {"2040-01-02"},
 		},
 		expectedStatusCode: http.StatusOK,
 	},
 	{
 		name:               "empty post body",
 		postedData:         url.Values{},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 	{
 		name: "start date wrong format",
 		postedData: url.Values{
-			"start":   {"invalid"},
-			"end":     {"2040-01-02"},
-			"room_id": {"1"},
+			"start": {"invalid"},
+			"end":   {"2040-01-02"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 	{
 		name: "end date wrong format",
@@ -434,7 +390,7 @@ var testPostAvailabilityData = []struct {
 			"start": {"2040-01-01"},
 			"end":   {"invalid"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 	{
 		name: "database query fails",
@@ -442,7 +398,7 @@ var testPostAvailabilityData = []struct {
 			"start": {"2060-01-01"},
 			"end":   {"2060-01-02"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 }
 
@@ -457,6 +413,7 @@ func TestPostAvailability(t *testing.T) {
 
 		// set the request header
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_ = req.ParseForm()
 		rr := httptest.NewRecorder()
 
 		// make our handler a http.HandlerFunc and call
@@ -466,6 +423,12 @@ func TestPostAvailability(t *testing.T) {
 		if rr.Code != e.expectedStatusCode {
 			t.Errorf("%s gave wrong status code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
 		}
+
+		if e.expectedLocation != "" {
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
+			}
+		}
 	}
 }
 
@@ -494,7 +457,7 @@ var reservationSummaryTests = []struct {
 		name:               "res-not-in-session",
 		reservation:        models.Reservation{},
 		url:                "/reservation-summary",
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 		expectedLocation:   "/",
 	},
 }
@@ -520,9 +483,8 @@ func TestReservationSummary(t *testing.T) {
 		}
 
 		if e.expectedLocation != "" {
-			actualLoc, _ := rr.Result().Location()
-			if actualLoc.String() != e.expectedLocation {
-				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
 			}
 		}
 	}
@@ -532,7 +494,7 @@ func TestReservationSummary(t *testing.T) {
 var chooseRoomTests = []struct {
 	name               string
 	reservation        models.Reservation
-	url                string
+	id                 string
 	expectedStatusCode int
 	expectedLocation   string
 }{
@@ -545,34 +507,30 @@ var chooseRoomTests = []struct {
 				RoomName: "General's Quarters",
 			},
 		},
-		url:                "/choose-room/1",
+		id:                 "1",
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/make-reservation",
 	},
 	{
 		name:               "reservation-not-in-session",
 		reservation:        models.Reservation{},
-		url:                "/choose-room/1",
-		expectedStatusCode: http.StatusSeeOther,
-		expectedLocation:   "/",
+		id:                 "1",
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 	{
 		name:               "malformed-url",
 		reservation:        models.Reservation{},
-		url:                "/choose-room/fish",
-		expectedStatusCode: http.StatusSeeOther,
-		expectedLocation:   "/",
+		id:                 "fish",
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 }
 
 // TestChooseRoom tests the ChooseRoom handler
 func TestChooseRoom(t *testing.T) {
 	for _, e := range chooseRoomTests {
-		req, _ := http.NewRequest("GET", e.url, nil)
+		req, _ := http.NewRequest("GET", "/choose-room/"+e.id, nil)
 		ctx := getCtx(req)
-		req = req.WithContext(ctx)
-		// set the RequestURI on the request so that we can grab the ID from the URL
-		req.RequestURI = e.url
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
 
 		rr := httptest.NewRecorder()
 		if e.reservation.RoomID > 0 {
@@ -587,9 +545,8 @@ func TestChooseRoom(t *testing.T) {
 		}
 
 		if e.expectedLocation != "" {
-			actualLoc, _ := rr.Result().Location()
-			if actualLoc.String() != e.expectedLocation {
-				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
 			}
 		}
 	}
@@ -603,39 +560,30 @@ var bookRoomTests = []struct {
 }{
 	{
 		name:               "database-works",
-		url:                "/book-room?s=2050-01-01&e=2050-01-02&id=1",
+		url:                "/book-room?sd=2040-01-01&ed=2040-01-02&id=1",
 		expectedStatusCode: http.StatusSeeOther,
 	},
 	{
 		name:               "database-fails",
-		url:                "/book-room?s=2040-01-01&e=2040-01-02&id=4",
-		expectedStatusCode: http.StatusSeeOther,
+		url:                "/book-room?sd=2040-01-01&ed=2040-01-02&id=4",
+		expectedStatusCode: http.StatusInternalServerError,
 	},
 }
 
 // TestBookRoom tests the BookRoom handler
 func TestBookRoom(t *testing.T) {
-	reservation := models.Reservation{
-		RoomID: 1,
-		Room: models.Room{
-			ID:       1,
-			RoomName: "General's Quarters",
-		},
-	}
-
 	for _, e := range bookRoomTests {
 		req, _ := http.NewRequest("GET", e.url, nil)
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 
 		rr := httptest.NewRecorder()
-		session.Put(ctx, "reservation", reservation)
 
 		handler := http.HandlerFunc(Repo.BookRoom)
 
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusSeeOther {
+		if rr.Code != e.expectedStatusCode {
 			t.Errorf("%s failed: returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
 		}
 	}
@@ -661,13 +609,13 @@ var loginTests = []struct {
 		"jack@nimble.com",
 		http.StatusSeeOther,
 		"",
-		"/user/login",
+		"/users/login",
 	},
 	{
 		"invalid-data",
 		"j",
 		http.StatusOK,
-		`action="/user/login"`,
+		`action="/users/login"`,
 		"",
 	},
 }
@@ -680,7 +628,7 @@ func TestLogin(t *testing.T) {
 		postedData.Add("password", "password")
 
 		// create request
-		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+		req, _ := http.NewRequest("POST", "/users/login", strings.NewReader(postedData.Encode()))
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 
@@ -689,7 +637,7 @@ func TestLogin(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// call the handler
-		handler := http.HandlerFunc(Repo.PostShowLogin)
+		handler := http.HandlerFunc(Repo.PostLogin)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedStatusCode {
@@ -697,10 +645,8 @@ func TestLogin(t *testing.T) {
 		}
 
 		if e.expectedLocation != "" {
-			// get the URL from test
-			actualLoc, _ := rr.Result().Location()
-			if actualLoc.String() != e.expectedLocation {
-				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
 			}
 		}
 
@@ -715,9 +661,10 @@ func TestLogin(t *testing.T) {
 	}
 }
 
-var adminPostShowReservationTests = []struct {
+var adminUpdateReservationTests = []struct {
 	name                 string
-	url                  string
+	src                  string
+	id                   string
 	postedData           url.Values
 	expectedResponseCode int
 	expectedLocation     string
@@ -725,66 +672,80 @@ var adminPostShowReservationTests = []struct {
 }{
 	{
 		name: "valid-data-from-new",
-		url:  "/admin/reservations/new/1/show",
+		src:  "new",
+		id:   "1",
 		postedData: url.Values{
-			"first_name": {"John"},
-			"last_name":  {"Smith"},
-			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
+			"first_name":  {"John"},
+			"last_name":   {"Smith"},
+			"email":       {"john@smith.com"},
+			"phone":       {"555-555-5555"},
+			"total_price": {"120.00"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "/admin/reservations-new",
+		expectedLocation:     "/admin/reservations/new",
 		expectedHTML:         "",
 	},
 	{
 		name: "valid-data-from-all",
-		url:  "/admin/reservations/all/1/show",
+		src:  "all",
+		id:   "1",
 		postedData: url.Values{
-			"first_name": {"John"},
-			"last_name":  {"Smith"},
-			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
+			"first_name":  {"John"},
+			"last_name":   {"Smith"},
+			"email":       {"john@smith.com"},
+			"phone":       {"555-555-5555"},
+			"total_price": {"120.00"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "/admin/reservations-all",
+		expectedLocation:     "/admin/reservations/all",
 		expectedHTML:         "",
 	},
 	{
-		name: "valid-data-from-cal",
-		url:  "/admin/reservations/cal/1/show",
+		name: "invalid-data",
+		src:  "all",
+		id:   "1",
 		postedData: url.Values{
-			"first_name": {"John"},
-			"last_name":  {"Smith"},
-			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
-			"year":       {"2022"},
-			"month":      {"01"},
+			"first_name":  {"J"},
+			"last_name":   {"Smith"},
+			"email":       {"john@smith.com"},
+			"phone":       {"555-555-5555"},
+			"total_price": {"120.00"},
 		},
-		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "/admin/reservations-calendar?y=2022&m=01",
+		expectedResponseCode: http.StatusOK,
+		expectedLocation:     "",
+		expectedHTML:         "must be at least 3 characters long",
+	},
+	{
+		name: "non-existent-reservation",
+		src:  "all",
+		id:   "3",
+		postedData: url.Values{
+			"first_name":  {"John"},
+			"last_name":   {"Smith"},
+			"email":       {"john@smith.com"},
+			"phone":       {"555-555-5555"},
+			"total_price": {"120.00"},
+		},
+		expectedResponseCode: http.StatusInternalServerError,
+		expectedLocation:     "",
 		expectedHTML:         "",
 	},
 }
 
-// TestAdminPostShowReservation tests the AdminPostReservation handler
-func TestAdminPostShowReservation(t *testing.T) {
-	for _, e := range adminPostShowReservationTests {
-		var req *http.Request
-		if e.postedData != nil {
-			req, _ = http.NewRequest("POST", "/user/login", strings.NewReader(e.postedData.Encode()))
-		} else {
-			req, _ = http.NewRequest("POST", "/user/login", nil)
-		}
+// TestAdminUpdateReservation tests the AdminUpdateReservation handler
+func TestAdminUpdateReservation(t *testing.T) {
+	for _, e := range adminUpdateReservationTests {
+		url := fmt.Sprintf("/admin/reservations/%s/%s", e.src, e.id)
+		req, _ := http.NewRequest("POST", url, strings.NewReader(e.postedData.Encode()))
 		ctx := getCtx(req)
-		req = req.WithContext(ctx)
-		req.RequestURI = e.url
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": e.src, "id": e.id})
 
 		// set the header
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
 
 		// call the handler
-		handler := http.HandlerFunc(Repo.AdminPostShowReservation)
+		handler := http.HandlerFunc(Repo.AdminUpdateReservation)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedResponseCode {
@@ -792,10 +753,8 @@ func TestAdminPostShowReservation(t *testing.T) {
 		}
 
 		if e.expectedLocation != "" {
-			// get the URL from test
-			actualLoc, _ := rr.Result().Location()
-			if actualLoc.String() != e.expectedLocation {
-				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
 			}
 		}
 
@@ -816,6 +775,7 @@ var adminPostReservationCalendarTests = []struct {
 	expectedResponseCode int
 	expectedLocation     string
 	expectedHTML         string
+	expectedError        string
 	blocks               int
 	reservations         int
 }{
@@ -828,6 +788,17 @@ var adminPostReservationCalendarTests = []struct {
 		},
 		expectedResponseCode: http.StatusSeeOther,
 	},
+	{
+		name: "cal-taken",
+		postedData: url.Values{
+			"year":                  {"2050"},
+			"month":                 {"01"},
+			"add_block_1_2050-01-5": {"1"},
+			"add_block_1_2050-01-3": {"1"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedError:        "Could not block 2050-01-03, 2050-01-05: already reserved or blocked",
+	},
 	{
 		name:                 "cal-blocks",
 		postedData:           url.Values{},
@@ -891,80 +862,152 @@ func TestPostReservationCalendar(t *testing.T) {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
 
+		if actualError := session.GetString(ctx, "error"); actualError != e.expectedError {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, actualError)
+		}
+
 	}
 }
 
 var adminProcessReservationTests = []struct {
 	name                 string
-	queryParams          string
+	id                   string
+	status               string
 	expectedResponseCode int
 	expectedLocation     string
 }{
 	{
 		name:                 "process-reservation",
-		queryParams:          "",
+		id:                   "1",
+		status:               models.StatusConfirmed,
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		expectedLocation:     "/admin/reservations/new",
 	},
 	{
-		name:                 "process-reservation-back-to-cal",
-		queryParams:          "?y=2021&m=12",
+		name:                 "invalid-transition",
+		id:                   "1",
+		status:               models.StatusPending,
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		expectedLocation:     "/admin/reservations/new/1",
+	},
+	{
+		name:                 "malformed-id",
+		id:                   "fish",
+		status:               models.StatusConfirmed,
+		expectedResponseCode: http.StatusInternalServerError,
 	},
 }
 
 func TestAdminProcessReservation(t *testing.T) {
 	for _, e := range adminProcessReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+		postedData := url.Values{"status": {e.status}}
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/process-reservation/new/%s", e.id), strings.NewReader(postedData.Encode()))
 		ctx := getCtx(req)
-		req = req.WithContext(ctx)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": "new", "id": e.id})
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 		rr := httptest.NewRecorder()
 
 		handler := http.HandlerFunc(Repo.AdminProcessReservation)
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusSeeOther {
+		if rr.Code != e.expectedResponseCode {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
+
+		if e.expectedLocation != "" {
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
+			}
+		}
 	}
 }
 
 var adminDeleteReservationTests = []struct {
 	name                 string
-	queryParams          string
+	id                   string
 	expectedResponseCode int
 	expectedLocation     string
 }{
 	{
 		name:                 "delete-reservation",
-		queryParams:          "",
+		id:                   "1",
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		expectedLocation:     "/admin/reservations/all",
 	},
 	{
-		name:                 "delete-reservation-back-to-cal",
-		queryParams:          "?y=2021&m=12",
-		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		name:                 "non-existent-reservation",
+		id:                   "3",
+		expectedResponseCode: http.StatusInternalServerError,
 	},
 }
 
 func TestAdminDeleteReservation(t *testing.T) {
 	for _, e := range adminDeleteReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/delete-reservations/all/%s", e.id), nil)
 		ctx := getCtx(req)
-		req = req.WithContext(ctx)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": "all", "id": e.id})
 
 		rr := httptest.NewRecorder()
 
 		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusSeeOther {
+		if rr.Code != e.expectedResponseCode {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
+
+		if e.expectedLocation != "" {
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
+			}
+		}
+	}
+}
+
+// adminDeleteRoomTests is the data for the AdminDeleteRoom handler tests, /admin/rooms/{id}/delete
+var adminDeleteRoomTests = []struct {
+	name             string
+	id               string
+	expectedLocation string
+	expectedError    string
+}{
+	{
+		name:             "delete-room",
+		id:               "1",
+		expectedLocation: "/admin/rooms",
+	},
+	{
+		name:             "room-in-use",
+		id:               "3",
+		expectedLocation: "/admin/rooms/3",
+		expectedError:    "Room has reservations or upcoming blocks and cannot be deleted",
+	},
+}
+
+// TestAdminDeleteRoom tests the AdminDeleteRoom handler
+func TestAdminDeleteRoom(t *testing.T) {
+	for _, e := range adminDeleteRoomTests {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/%s/delete", e.id), nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if actualLoc := location(rr); actualLoc != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
+		}
+
+		if actualError := session.GetString(ctx, "error"); actualError != e.expectedError {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, actualError)
+		}
 	}
 }
 
@@ -976,3 +1019,21 @@ func getCtx(req *http.Request) context.Context {
 	}
 	return ctx
 }
+
+// withURLParams adds chi URL parameters to a request, as the router does
+func withURLParams(req *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// location returns the redirect location of a response, or "" if there is none
+func location(rr *httptest.ResponseRecorder) string {
+	loc, err := rr.Result().Location()
+	if err != nil {
+		return ""
+	}
+	return loc.String()
+}
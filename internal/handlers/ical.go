@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/ical"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// restriction ids of the restrictions table
+const (
+	restrictionReservation = 1
+	restrictionOwnerBlock  = 2
+)
+
+// roomFeedLink returns the address other booking sites use to read a room's calendar
+func (m *Repository) roomFeedLink(roomID int, token string) string {
+	return fmt.Sprintf("%s/ical/rooms/%d.ics?token=%s", m.App.BaseURL, roomID, url.QueryEscape(token))
+}
+
+// RoomICalFeed serves the reservations and blocks of a room as an iCalendar feed. The feed
+// is protected by the room's secret token and only tells busy dates, not who the guests are.
+func (m *Repository) RoomICalFeed(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	token, err := m.DB.GetRoomICalToken(roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	given := r.URL.Query().Get("token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(given)) != 1 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	restrictions, err := m.DB.GetRestrictionsForRoom(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	host := "bookings"
+	if u, err := url.Parse(m.App.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	cal := ical.Calendar{
+		ProdID: "-//Bookings//Room Availability//EN",
+		Method: ical.MethodPublish,
+		Name:   fmt.Sprintf("%s - %s", m.App.Property.Name, room.RoomName),
+	}
+
+	for _, rr := range restrictions {
+		summary := "Not available"
+		switch rr.RestrictionID {
+		case restrictionReservation:
+			summary = "Reserved"
+		case restrictionOwnerBlock:
+			summary = "Blocked"
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:     fmt.Sprintf("restriction-%d@%s", rr.ID, host),
+			Summary: summary,
+			Start:   rr.StartDate,
+			End:     rr.EndDate,
+			AllDay:  true,
+		})
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="room-%d.ics"`, roomID))
+	_, err = cal.WriteTo(w)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// AdminRoomICalToken gives a room's calendar feed a new secret token, so the old link stops working
+func (m *Repository) AdminRoomICalToken(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	b := make([]byte, 24)
+	_, err = rand.Read(b)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.UpdateRoomICalToken(roomID, hex.EncodeToString(b))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "A new calendar feed link has been created")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+}
+
+// AdminICalFeeds shows the external calendars imported into rooms with their last sync status
+func (m *Repository) AdminICalFeeds(w http.ResponseWriter, r *http.Request) {
+	m.renderICalFeeds(w, r, forms.New(nil))
+}
+
+// renderICalFeeds renders the external calendars page with the given add feed form
+func (m *Repository) renderICalFeeds(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	feeds, err := m.DB.AllICalFeeds()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["feeds"] = feeds
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-ical-feeds.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostICalFeed adds an external calendar to a room and imports it right away
+func (m *Repository) AdminPostICalFeed(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "name", "url")
+	form.IsURL("url")
+
+	if !form.Valid() {
+		m.renderICalFeeds(w, r, form)
+		return
+	}
+
+	var feed models.ICalFeed
+	feed.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	feed.Name = strings.TrimSpace(r.Form.Get("name"))
+	feed.URL = strings.TrimSpace(r.Form.Get("url"))
+
+	feed.ID, err = m.auditDB(r).InsertICalFeed(feed)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// sync errors are recorded on the feed and shown in the list
+	_, _ = m.ICalSync.SyncFeed(feed)
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar added")
+	http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+}
+
+// AdminSyncICalFeed imports an external calendar now instead of waiting for the next sync
+func (m *Repository) AdminSyncICalFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	feed, err := m.DB.GetICalFeedByID(feedID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	result, err := m.ICalSync.SyncFeed(feed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Cannot sync %s: %v", feed.Name, err))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s synced: %d added, %d updated, %d removed",
+			feed.Name, result.Added, result.Updated, result.Removed))
+	}
+
+	http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+}
+
+// AdminDeleteICalFeed removes an external calendar and the restrictions imported from it
+func (m *Repository) AdminDeleteICalFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.auditDB(r).DeleteICalFeed(feedID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar deleted")
+	http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// recentLoginFailures is how many failed logins the admin page shows
+const recentLoginFailures = 100
+
+// recordLoginFailure adds a failed login attempt for email to the audit log
+func (m *Repository) recordLoginFailure(r *http.Request, email, reason string) {
+	err := m.DB.InsertLoginFailure(models.LoginFailure{
+		Email:     email,
+		IPAddress: helpers.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Reason:    reason,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println("cannot record failed login:", err)
+	}
+}
+
+// loginThrottled reports whether a login attempt for email from the client must wait or is locked
+// out. If so, the attempt is recorded and the visitor is sent back to the login page with the reason.
+func (m *Repository) loginThrottled(w http.ResponseWriter, r *http.Request, email string) bool {
+	throttle := m.App.LoginThrottle
+	now := time.Now()
+
+	account, byIP, err := m.DB.LoginFailureCounts(email, helpers.ClientIP(r), now.Add(-throttle.Window))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return true
+	}
+
+	wait, locked := throttle.Check(account, byIP, now)
+	if wait <= 0 {
+		return false
+	}
+
+	m.recordLoginFailure(r, email, models.LoginFailureThrottled)
+
+	if locked {
+		minutes := int(math.Ceil(wait.Minutes()))
+		m.App.Session.Put(r.Context(), "error",
+			fmt.Sprintf("Too many failed logins, try again in %d minutes or ask an administrator to unlock the account", minutes))
+	} else {
+		seconds := int(math.Ceil(wait.Seconds()))
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Too many failed logins, try again in %d seconds", seconds))
+	}
+	http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+	return true
+}
+
+// AdminLogins shows the accounts locked out by failed logins and the latest failed attempts
+func (m *Repository) AdminLogins(w http.ResponseWriter, r *http.Request) {
+	throttle := m.App.LoginThrottle
+
+	locked, err := m.DB.LockedAccounts(time.Now().Add(-throttle.Window), throttle.AccountLockout)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	failures, err := m.DB.RecentLoginFailures(recentLoginFailures)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["locked"] = locked
+	data["failures"] = failures
+
+	render.Template(w, r, "admin-logins.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminUnlockLogin clears the failed logins of an account, so its user can log in again at once
+func (m *Repository) AdminUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	email := r.Form.Get("email")
+	err = m.DB.ClearLoginFailures(email)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s has been unlocked", email))
+	http.Redirect(w, r, "/admin/logins", http.StatusSeeOther)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/pricing"
+	"bookings/internal/render"
+	"bookings/internal/repository"
+	"bookings/internal/signer"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// bookingLinkPurpose separates guest booking links from other tokens signed with the same key
+const bookingLinkPurpose = "my-booking"
+
+// bookingLink returns the signed link guests use to manage a reservation, valid until the day after departure
+func (m *Repository) bookingLink(res models.Reservation) string {
+	token := m.App.Signer.Sign(bookingLinkPurpose, res.ID, res.EndDate.AddDate(0, 0, 1))
+	return fmt.Sprintf("%s/my-booking/%s", m.App.BaseURL, token)
+}
+
+// guestReservation loads the reservation of the signed token in the URL. On failure it sends the
+// guest to the home page with an error and returns false.
+func (m *Repository) guestReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	resID, err := m.App.Signer.Verify(bookingLinkPurpose, chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		message := "This booking link is not valid"
+		if errors.Is(err, signer.ErrExpiredToken) {
+			message = "This booking link has expired"
+		}
+		m.App.Session.Put(r.Context(), "error", message)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationByID(resID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot find this booking")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	return res, true
+}
+
+// MyBooking shows guests their booking with forms to change the dates or cancel it
+func (m *Repository) MyBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservation(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderMyBooking(w, r, res, forms.New(nil))
+}
+
+// renderMyBooking renders the guest booking page with the given change dates form
+func (m *Repository) renderMyBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	now := time.Now()
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["policy"] = m.App.CancellationPolicy
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = chi.URLParam(r, "token")
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+	stringMap["free_until"] = helpers.ConvertDateToString(res.StartDate.AddDate(0, 0, -m.App.CancellationPolicy.FreeDays))
+
+	intMap := make(map[string]int)
+	intMap["cancellation_fee"] = m.App.CancellationPolicy.Fee(res, now)
+	intMap["can_change"] = 0
+	if models.GuestCanChange(res, now) {
+		intMap["can_change"] = 1
+	}
+
+	render.Template(w, r, "my-booking.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Form:      form,
+	})
+}
+
+// PostMyBookingCancel cancels a booking on behalf of the guest, charging the policy's fee
+func (m *Repository) PostMyBookingCancel(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservation(w, r)
+	if !ok {
+		return
+	}
+
+	link := fmt.Sprintf("/my-booking/%s", chi.URLParam(r, "token"))
+	now := time.Now()
+
+	if !models.GuestCanChange(res, now) {
+		m.App.Session.Put(r.Context(), "error", "This booking can no longer be cancelled online")
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+
+	fee := m.App.CancellationPolicy.Fee(res, now)
+
+	err := m.DB.CancelReservation(res.ID, fee, reservationEvent(models.EventReservationCancelled))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res.Status = models.StatusCancelled
+	res.CancellationFee = fee
+	res.Sequence++
+	m.sendEmail(m.cancellationEmail(res))
+
+	m.notifyAdmin("Reservation cancelled by guest", fmt.Sprintf(
+		"Reservation %d for %s from %s to %s was cancelled by the guest. Cancellation fee: %s",
+		res.ID, res.Room.RoomName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"),
+		pricing.FormatAmount(fee)))
+
+	m.App.Session.Put(r.Context(), "flash", "Your booking has been cancelled")
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
+
+// PostMyBookingChange moves a booking to new dates if the room is free and its stay rules allow them
+func (m *Repository) PostMyBookingChange(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservation(w, r)
+	if !ok {
+		return
+	}
+
+	link := fmt.Sprintf("/my-booking/%s", chi.URLParam(r, "token"))
+	now := time.Now()
+
+	if !models.GuestCanChange(res, now) {
+		m.App.Session.Put(r.Context(), "error", "This booking can no longer be changed online")
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("start_date", "end_date")
+
+	startDate, err := helpers.ConvertStringToDate(r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	} else if !startDate.After(now) {
+		form.Errors.Add("start_date", "Arrival must be in the future")
+	}
+	endDate, err := helpers.ConvertStringToDate(r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Invalid date")
+	} else if !endDate.After(startDate) {
+		form.Errors.Add("end_date", "Departure must be after arrival")
+	}
+
+	if !form.Valid() {
+		m.renderMyBooking(w, r, res, form)
+		return
+	}
+
+	reason, err := m.stayRuleViolation(res.RoomID, startDate, endDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+
+	quote, err := m.Pricing.QuoteStay(res.RoomID, startDate, endDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	oldStart, oldEnd := res.StartDate, res.EndDate
+	res.StartDate = startDate
+	res.EndDate = endDate
+	res.TotalPrice = quote.Total
+	res.PriceLines = quote.Lines
+
+	err = m.DB.ChangeReservationDates(res, reservationEvent(models.EventReservationUpdated))
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room is not available for those dates")
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res.Sequence++
+	m.sendEmail(m.updateEmail(res))
+
+	m.notifyAdmin("Reservation changed by guest", fmt.Sprintf(
+		"Reservation %d for %s was moved by the guest from %s - %s to %s - %s. New total: %s",
+		res.ID, res.Room.RoomName, oldStart.Format("2006-01-02"), oldEnd.Format("2006-01-02"),
+		startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), pricing.FormatAmount(quote.Total)))
+
+	m.App.Session.Put(r.Context(), "flash", "Your booking has been changed")
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bookings/internal/models"
+	"bookings/internal/openapi"
+	"encoding/json"
+	"net/http"
+)
+
+// apiBearerAuth is the name of the API token security scheme
+const apiBearerAuth = "bearerAuth"
+
+// APISpec describes every route of the API. The schemas are generated from the same types the
+// handlers read and write, so they cannot drift apart.
+func APISpec() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Bookings API",
+		Version: "1.0.0",
+		Description: "Rooms, availability and reservations. Dates are formatted as YYYY-MM-DD and amounts " +
+			"are in cents. Successful responses wrap their payload in a data object, failed ones return an error object.",
+	}, openapi.Server{URL: "/api/v1"})
+
+	doc.Components.SecuritySchemes[apiBearerAuth] = openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "API token",
+		Description:  "An API token created on the admin profile page",
+	}
+
+	idParam := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}}
+
+	doc.Add(http.MethodGet, "/rooms", openapi.Operation{
+		OperationID: "listRooms",
+		Summary:     "List all rooms",
+		Tags:        []string{"rooms"},
+		Responses: map[string]openapi.Response{
+			"200": apiDataResponse(doc, "The rooms", []models.APIRoom{}),
+		},
+	})
+
+	doc.Add(http.MethodGet, "/rooms/{id}", openapi.Operation{
+		OperationID: "getRoom",
+		Summary:     "Show a room",
+		Tags:        []string{"rooms"},
+		Parameters:  []openapi.Parameter{idParam},
+		Responses: map[string]openapi.Response{
+			"200": apiDataResponse(doc, "The room", models.APIRoom{}),
+			"404": apiErrorResponse(doc, "There is no such room"),
+		},
+	})
+
+	doc.Add(http.MethodGet, "/availability", openapi.Operation{
+		OperationID: "searchAvailability",
+		Summary:     "List the rooms that can be booked for a stay, with its price",
+		Tags:        []string{"availability"},
+		Parameters: []openapi.Parameter{
+			{Name: "start_date", In: "query", Required: true, Description: "Arrival date",
+				Schema: &openapi.Schema{Type: "string", Format: "date"}},
+			{Name: "end_date", In: "query", Required: true, Description: "Departure date",
+				Schema: &openapi.Schema{Type: "string", Format: "date"}},
+			{Name: "room_id", In: "query", Description: "Only check this room",
+				Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Responses: map[string]openapi.Response{
+			"200": apiDataResponse(doc, "The available rooms", models.APIAvailability{}),
+			"422": apiErrorResponse(doc, "The dates are missing or invalid"),
+		},
+	})
+
+	doc.Add(http.MethodPost, "/reservations", openapi.Operation{
+		OperationID: "createReservation",
+		Summary:     "Book a room and email the guest a confirmation",
+		Tags:        []string{"reservations"},
+		RequestBody: apiRequestBody(doc, models.APIReservationRequest{}),
+		Responses: map[string]openapi.Response{
+			"201": apiDataResponse(doc, "The reservation", models.APIReservation{}),
+			"400": apiErrorResponse(doc, "The body is not valid JSON"),
+			"409": apiErrorResponse(doc, "The room is not available for these dates"),
+			"415": apiErrorResponse(doc, "The body is not sent as application/json"),
+			"422": apiErrorResponse(doc, "The reservation is invalid or breaks a stay rule"),
+		},
+	})
+
+	doc.Add(http.MethodGet, "/reservations/{id}", openapi.Operation{
+		OperationID: "getReservation",
+		Summary:     "Show a reservation",
+		Tags:        []string{"reservations"},
+		Parameters:  []openapi.Parameter{idParam},
+		Security:    []map[string][]string{{apiBearerAuth: {}}},
+		Responses: apiAuthResponses(doc, map[string]openapi.Response{
+			"200": apiDataResponse(doc, "The reservation", models.APIReservation{}),
+			"404": apiErrorResponse(doc, "There is no such reservation"),
+		}),
+	})
+
+	doc.Add(http.MethodPost, "/reservations/{id}/cancel", openapi.Operation{
+		OperationID: "cancelReservation",
+		Summary:     "Cancel a reservation, charging the fee of the cancellation policy. Needs a write token.",
+		Tags:        []string{"reservations"},
+		Parameters:  []openapi.Parameter{idParam},
+		Security:    []map[string][]string{{apiBearerAuth: {}}},
+		Responses: apiAuthResponses(doc, map[string]openapi.Response{
+			"200": apiDataResponse(doc, "The cancelled reservation", models.APIReservation{}),
+			"404": apiErrorResponse(doc, "There is no such reservation"),
+			"409": apiErrorResponse(doc, "The reservation cannot be cancelled in its status"),
+		}),
+	})
+
+	doc.Add(http.MethodGet, "/openapi.json", openapi.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This document",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The OpenAPI document of the API",
+				Content:     map[string]openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "object"}}},
+			},
+		},
+	})
+
+	return doc
+}
+
+// apiDataResponse describes a successful response with v in the data envelope
+func apiDataResponse(doc *openapi.Document, description string, v interface{}) openapi.Response {
+	envelope := &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"data": doc.Schema(v)},
+		Required:   []string{"data"},
+	}
+
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: envelope}},
+	}
+}
+
+// apiErrorResponse describes a response with an error envelope
+func apiErrorResponse(doc *openapi.Document, description string) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: doc.Schema(models.APIError{})}},
+	}
+}
+
+// apiRequestBody describes a required JSON request body of the type of v
+func apiRequestBody(doc *openapi.Document, v interface{}) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"application/json": {Schema: doc.Schema(v)}},
+	}
+}
+
+// apiAuthResponses adds the responses of RequireAPIToken to the responses of a route needing a token
+func apiAuthResponses(doc *openapi.Document, responses map[string]openapi.Response) map[string]openapi.Response {
+	responses["401"] = apiErrorResponse(doc, "The API token is missing, invalid or expired")
+	responses["403"] = apiErrorResponse(doc, "The API token does not have the scope or its user the access level")
+	return responses
+}
+
+// APIOpenAPI serves the OpenAPI document of the API
+func (m *Repository) APIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	out, err := json.MarshalIndent(APISpec(), "", "  ")
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
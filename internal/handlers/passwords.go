@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bookings/internal/apitoken"
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"bookings/internal/repository"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// resetLifetime is how long the link in a password reset email can be used
+const resetLifetime = time.Hour
+
+// passwordPaths are the pages where the one-time token of each purpose is used to choose a password
+var passwordPaths = map[string]string{
+	models.UserTokenInvite: "/users/set-password",
+	models.UserTokenReset:  "/users/reset-password",
+}
+
+// passwordLink returns the link to the page where token is used to choose a password
+func (m *Repository) passwordLink(purpose, token string) string {
+	return fmt.Sprintf("%s%s/%s", m.App.BaseURL, passwordPaths[purpose], token)
+}
+
+// newUserToken stores a one-time token for user and returns the token to put in a link
+func (m *Repository) newUserToken(user models.User, purpose string, lifetime time.Duration) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	_, err = m.DB.InsertUserToken(models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: apitoken.Hash(token),
+		ExpiresAt: time.Now().Add(lifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ShowForgotPassword renders the form to ask for a password reset link
+func (m *Repository) ShowForgotPassword(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "forgot-password.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostForgotPassword emails a password reset link to an active user with the address. The answer is
+// the same whether or not there is such a user, so the form cannot be used to find out who has an account.
+func (m *Repository) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "forgot-password.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	user, err := m.DB.GetUserByEmail(form.Get("email"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if err == nil && user.Active {
+		token, err := m.newUserToken(user, models.UserTokenReset, resetLifetime)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		stringMap := make(map[string]string)
+		stringMap["link"] = m.passwordLink(models.UserTokenReset, token)
+
+		data := make(map[string]interface{})
+		data["user"] = user
+
+		m.sendEmail(m.newEmail(user.Email, "password-reset", &models.EmailData{
+			Subject:   "Reset Your Password",
+			StringMap: stringMap,
+			Data:      data,
+		}))
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "If there is an account for that address, a link to reset its password is on its way")
+	http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+}
+
+// ShowSetPassword renders the form where a user with an invitation link chooses a password
+func (m *Repository) ShowSetPassword(w http.ResponseWriter, r *http.Request) {
+	m.showPasswordForm(w, r, models.UserTokenInvite)
+}
+
+// PostSetPassword uses up an invitation link to set the user's password
+func (m *Repository) PostSetPassword(w http.ResponseWriter, r *http.Request) {
+	m.postPasswordForm(w, r, models.UserTokenInvite, "Your password has been set, you can now log in")
+}
+
+// ShowResetPassword renders the form where a user with a password reset link chooses a new password
+func (m *Repository) ShowResetPassword(w http.ResponseWriter, r *http.Request) {
+	m.showPasswordForm(w, r, models.UserTokenReset)
+}
+
+// PostResetPassword uses up a password reset link to change the user's password, logging them out everywhere
+func (m *Repository) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	m.postPasswordForm(w, r, models.UserTokenReset, "Your password has been changed, you can now log in")
+}
+
+// showPasswordForm renders the password form if the token in the URL can still be used for purpose
+func (m *Repository) showPasswordForm(w http.ResponseWriter, r *http.Request, purpose string) {
+	token := chi.URLParam(r, "token")
+
+	_, err := m.DB.GetUserTokenByHash(purpose, apitoken.Hash(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This link has already been used or has expired")
+		http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderPasswordForm(w, r, purpose, token, forms.New(nil))
+}
+
+// renderPasswordForm renders the page to choose a password with token with the given form errors
+func (m *Repository) renderPasswordForm(w http.ResponseWriter, r *http.Request, purpose, token string, form *forms.Form) {
+	stringMap := make(map[string]string)
+	stringMap["action"] = fmt.Sprintf("%s/%s", passwordPaths[purpose], token)
+	if purpose == models.UserTokenReset {
+		stringMap["title"] = "Reset Your Password"
+	} else {
+		stringMap["title"] = "Set Your Password"
+	}
+
+	render.Template(w, r, "set-password.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
+
+// postPasswordForm checks the posted password against the password policy and uses up the token in
+// the URL to set it
+func (m *Repository) postPasswordForm(w http.ResponseWriter, r *http.Request, purpose, flash string) {
+	token := chi.URLParam(r, "token")
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "password_confirm")
+	form.IsPassword("password")
+	form.Matches("password_confirm", "password")
+
+	if !form.Valid() {
+		m.renderPasswordForm(w, r, purpose, token, form)
+		return
+	}
+
+	_, err = m.DB.SetPasswordWithToken(purpose, apitoken.Hash(token), form.Get("password"))
+	if errors.Is(err, repository.ErrInvalidUserToken) {
+		m.App.Session.Put(r.Context(), "error", "This link has already been used or has expired")
+		http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+}
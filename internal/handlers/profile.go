@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bookings/internal/apitoken"
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiTokenLifetimes are the expiry choices, in days, offered for new API tokens
+var apiTokenLifetimes = []int{7, 30, 90, 365}
+
+// currentUser returns the logged in user. Without one it sends the visitor to the login page and returns false.
+func (m *Repository) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	user, ok := helpers.CurrentUser(r)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Log in first!")
+		http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// AdminProfile shows the logged in user with their API tokens
+func (m *Repository) AdminProfile(w http.ResponseWriter, r *http.Request) {
+	m.renderProfile(w, r, forms.New(nil))
+}
+
+// renderProfile renders the profile page with the given new API token form
+func (m *Repository) renderProfile(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := m.DB.APITokensForUser(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["tokens"] = tokens
+	data["lifetimes"] = apiTokenLifetimes
+
+	// a new token is shown once, right after it is created
+	stringMap := make(map[string]string)
+	stringMap["new_token"] = m.App.Session.PopString(r.Context(), "new_api_token")
+
+	render.Template(w, r, "admin-profile.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	})
+}
+
+// AdminPostAPIToken creates an API token for the logged in user
+func (m *Repository) AdminPostAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "scope", "lifetime")
+
+	scope := r.Form.Get("scope")
+	if scope != models.ScopeRead && scope != models.ScopeWrite {
+		form.Errors.Add("scope", "Choose read or write access")
+	}
+
+	days, _ := strconv.Atoi(r.Form.Get("lifetime"))
+	validLifetime := false
+	for _, d := range apiTokenLifetimes {
+		if d == days {
+			validLifetime = true
+		}
+	}
+	if !validLifetime {
+		form.Errors.Add("lifetime", "Choose when the token expires")
+	}
+
+	if !form.Valid() {
+		m.renderProfile(w, r, form)
+		return
+	}
+
+	plain, display, hash, err := apitoken.Generate()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.DB.InsertAPIToken(models.APIToken{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(r.Form.Get("name")),
+		Display:   display,
+		TokenHash: hash,
+		Scope:     scope,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "new_api_token", plain)
+	m.App.Session.Put(r.Context(), "flash", "API token created")
+	http.Redirect(w, r, "/admin/profile", http.StatusSeeOther)
+}
+
+// AdminDeleteAPIToken revokes one of the logged in user's API tokens
+func (m *Repository) AdminDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteAPIToken(tokenID, user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API token revoked")
+	http.Redirect(w, r, "/admin/profile", http.StatusSeeOther)
+}
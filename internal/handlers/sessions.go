@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// signOut ends the session with token, whichever store the sessions are kept in
+func (m *Repository) signOut(token string) error {
+	return m.App.Session.Store.Delete(token)
+}
+
+// signOutEverywhere ends all sessions of a user
+func (m *Repository) signOutEverywhere(userID int) error {
+	tokens, err := m.DB.DeleteUserSessionsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		err = m.signOut(token)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AdminSessions lists the browsers where the logged in user is logged in
+func (m *Repository) AdminSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := m.DB.UserSessionsForUser(user.ID, time.Now().Add(-m.App.Session.Lifetime))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	current := 0
+	token := m.App.Session.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == token {
+			current = s.ID
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["sessions"] = sessions
+	data["current"] = current
+
+	render.Template(w, r, "admin-sessions.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminSignOutSession signs the logged in user out of one of their sessions
+func (m *Repository) AdminSignOutSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token, err := m.DB.DeleteUserSession(sessionID, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This session has already ended")
+		http.Redirect(w, r, "/admin/profile/sessions", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if token == m.App.Session.Token(r.Context()) {
+		_ = m.App.Session.Destroy(r.Context())
+		_ = m.App.Session.RenewToken(r.Context())
+		http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+		return
+	}
+
+	err = m.signOut(token)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "The session has been signed out")
+	http.Redirect(w, r, "/admin/profile/sessions", http.StatusSeeOther)
+}
+
+// AdminSignOutEverywhere ends all sessions of the logged in user, this one included
+func (m *Repository) AdminSignOutEverywhere(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.signOutEverywhere(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_ = m.App.Session.Destroy(r.Context())
+	m.App.Session.Put(r.Context(), "flash", "You have been signed out everywhere")
+	http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+}
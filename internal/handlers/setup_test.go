@@ -11,13 +11,18 @@ import (
 	"testing"
 	"time"
 
+	"bookings/internal/config"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/permission"
+	"bookings/internal/pricing"
+	"bookings/internal/render"
+	"bookings/internal/signer"
+
 	"github.com/alexedwards/scs/v2"
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
-	"github.com/tsawler/bookings/internal/config"
-	"github.com/tsawler/bookings/internal/models"
-	"github.com/tsawler/bookings/internal/render"
 )
 
 var app config.AppConfig
@@ -25,10 +30,14 @@ var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
 
 var functions = template.FuncMap{
-	"humanDate":  render.HumanDate,
-	"formatDate": render.FormatDate,
-	"iterate":    render.Iterate,
-	"add":        render.Add,
+	"humanDate":    helpers.ConvertDateToString,
+	"formatDate":   helpers.FormatDate,
+	"iterate":      helpers.Iterate,
+	"add":          helpers.Add,
+	"money":        pricing.FormatAmount,
+	"nextStatuses": models.NextStatuses,
+	"can":          permission.Can,
+	"roleName":     permission.RoleName,
 }
 
 func TestMain(m *testing.M) {
@@ -54,12 +63,7 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
-
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-	defer close(mailChan)
-
-	listenForMail()
+	app.Signer = signer.New([]byte("test signing key"))
 
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
@@ -72,18 +76,11 @@ func TestMain(m *testing.M) {
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
 
-func listenForMail() {
-	go func() {
-		for {
-			_ = <-app.MailChan
-		}
-	}()
-}
-
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -93,8 +90,8 @@ func getRoutes() http.Handler {
 
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Get("/rooms", Repo.Rooms)
+	mux.Get("/rooms/{slug}", Repo.Room)
 
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
@@ -106,21 +103,21 @@ func getRoutes() http.Handler {
 	mux.Post("/make-reservation", Repo.PostReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
 
-	mux.Get("/user/login", Repo.ShowLogin)
-	mux.Post("/user/login", Repo.PostShowLogin)
-	mux.Get("/user/logout", Repo.Logout)
+	mux.Get("/users/login", Repo.ShowLogin)
+	mux.Post("/users/login", Repo.PostLogin)
+	mux.Get("/users/logout", Repo.Logout)
 
-	mux.Get("/admin/dashboard", Repo.AdminDashboard)
+	mux.Get("/admin/dashboard", Repo.AdminDashbord)
 
-	mux.Get("/admin/reservations-new", Repo.AdminNewReservations)
-	mux.Get("/admin/reservations-all", Repo.AdminAllReservations)
-	mux.Get("/admin/reservations-calendar", Repo.AdminReservationsCalendar)
-	mux.Post("/admin/reservations-calendar", Repo.AdminPostReservationsCalendar)
-	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
-	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Get("/admin/reservations/new", Repo.AdminNewReservations)
+	mux.Get("/admin/reservations/all", Repo.AdminAllReservations)
+	mux.Get("/admin/reservations/calendar", Repo.AdminReservationsCalendar)
+	mux.Post("/admin/reservations/calendar", Repo.AdminPostReservationsCalendar)
+	mux.Post("/admin/process-reservation/{src}/{id}", Repo.AdminProcessReservation)
+	mux.Post("/admin/delete-reservations/{src}/{id}", Repo.AdminDeleteReservation)
 
-	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
-	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
+	mux.Get("/admin/reservations/{src}/{id}", Repo.AdminShowReservation)
+	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminUpdateReservation)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
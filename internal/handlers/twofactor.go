@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"bookings/internal/apitoken"
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"bookings/internal/totp"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// twoFactorTimeout is how long a user has to enter their code after the password
+	twoFactorTimeout = 5 * time.Minute
+	// trustedDeviceLifetime is how long a trusted browser skips the two-factor step
+	trustedDeviceLifetime = 30 * 24 * time.Hour
+	// trustedDeviceCookie holds the token of a trusted browser, sent only to the login pages
+	trustedDeviceCookie = "trusted_device"
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+)
+
+// logIn starts the admin session of user, once their password and any second factor are checked,
+// records it in the user's sessions and stops their earlier failed logins from counting
+func (m *Repository) logIn(r *http.Request, user models.User) error {
+	err := m.App.Session.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "session_version", user.SessionVersion)
+
+	err = m.DB.InsertUserSession(models.UserSession{
+		UserID:     user.ID,
+		Token:      m.App.Session.Token(r.Context()),
+		IPAddress:  helpers.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+		LastSeenAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.ClearLoginFailures(user.Email)
+	if err != nil {
+		m.App.ErrorLog.Println("cannot clear failed logins:", err)
+	}
+
+	return nil
+}
+
+// isTrustedDevice reports whether the browser has a trusted device cookie for user
+func (m *Repository) isTrustedDevice(r *http.Request, user models.User) (bool, error) {
+	cookie, err := r.Cookie(trustedDeviceCookie)
+	if err != nil || cookie.Value == "" {
+		return false, nil
+	}
+
+	return m.DB.IsTrustedDevice(user.ID, apitoken.Hash(cookie.Value))
+}
+
+// trustDevice remembers the browser so user is not asked for a code on it for a while
+func (m *Repository) trustDevice(w http.ResponseWriter, r *http.Request, user models.User) error {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	_, err = m.DB.InsertTrustedDevice(models.TrustedDevice{
+		UserID:    user.ID,
+		TokenHash: apitoken.Hash(token),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: time.Now().Add(trustedDeviceLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     trustedDeviceCookie,
+		Value:    token,
+		Path:     "/users/login",
+		MaxAge:   int(trustedDeviceLifetime / time.Second),
+		HttpOnly: true,
+		Secure:   m.App.InProduction,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// checkSecondFactor checks a code from the authenticator app of user, or else one of their recovery
+// codes, and uses it up. It reports whether the code was good and whether it was a recovery code.
+func (m *Repository) checkSecondFactor(user models.User, code string) (ok, recovery bool, err error) {
+	if step, valid := totp.Verify(user.TOTPSecret, code, time.Now()); valid {
+		ok, err = m.DB.UseTOTPStep(user.ID, step)
+		return ok, false, err
+	}
+
+	ok, err = m.DB.UseRecoveryCode(user.ID, totp.HashRecoveryCode(code))
+	return ok, ok, err
+}
+
+// pendingLogin returns the user who entered their password and still has to pass the two-factor step.
+// Without one, or when it took too long, it sends the visitor back to the login page and returns false.
+func (m *Repository) pendingLogin(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	userID := m.App.Session.GetInt(r.Context(), "two_factor_user_id")
+	started := time.Unix(m.App.Session.GetInt64(r.Context(), "two_factor_started"), 0)
+
+	if userID == 0 || time.Since(started) > twoFactorTimeout {
+		m.App.Session.Remove(r.Context(), "two_factor_user_id")
+		m.App.Session.Remove(r.Context(), "two_factor_started")
+		m.App.Session.Put(r.Context(), "error", "Log in first!")
+		http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+		return models.User{}, false
+	}
+
+	user, err := m.DB.GetUserByID(userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// ShowLoginTwoFactor renders the second login step, asking for a code from the authenticator app
+func (m *Repository) ShowLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if _, ok := m.pendingLogin(w, r); !ok {
+		return
+	}
+
+	render.Template(w, r, "login-two-factor.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostLoginTwoFactor completes the login of a user who entered their password with a code from their
+// authenticator app or a recovery code
+func (m *Repository) PostLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.pendingLogin(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if m.loginThrottled(w, r, user.Email) {
+		return
+	}
+
+	flash := "Logged in successfully"
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if form.Valid() {
+		ok, recovery, err := m.checkSecondFactor(user, form.Get("code"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !ok {
+			m.recordLoginFailure(r, user.Email, models.LoginFailureTwoFactor)
+			form.Errors.Add("code", "This code is not valid")
+		} else if recovery {
+			flash = "Logged in with a recovery code, it cannot be used again"
+		}
+	}
+
+	if !form.Valid() {
+		render.Template(w, r, "login-two-factor.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	if form.Has("trust_device") {
+		err = m.trustDevice(w, r, user)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.App.Session.Remove(r.Context(), "two_factor_user_id")
+	m.App.Session.Remove(r.Context(), "two_factor_started")
+	err = m.logIn(r, user)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// AdminTwoFactor shows the two-factor settings of the logged in user. Until it is set up, it shows a
+// new secret as a QR code to scan with an authenticator app.
+func (m *Repository) AdminTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	stringMap := make(map[string]string)
+
+	if user.TwoFactorEnabled() {
+		left, err := m.DB.RecoveryCodesLeft(user.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		devices, err := m.DB.TrustedDevicesForUser(user.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data["recovery_codes_left"] = left
+		data["devices"] = devices
+		// new recovery codes are shown once, right after they are made
+		if codes := m.App.Session.PopString(r.Context(), "new_recovery_codes"); codes != "" {
+			data["new_recovery_codes"] = strings.Split(codes, "\n")
+		}
+	} else {
+		// the secret is kept in the session until a code from it confirms the app is set up
+		secret := m.App.Session.GetString(r.Context(), "totp_setup_secret")
+		if secret == "" {
+			var err error
+			secret, err = totp.GenerateSecret()
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			m.App.Session.Put(r.Context(), "totp_setup_secret", secret)
+		}
+
+		issuer := m.App.Property.Name
+		if issuer == "" {
+			issuer = "Bookings"
+		}
+		stringMap["secret"] = secret
+		stringMap["uri"] = totp.URI(issuer, user.Email, secret)
+	}
+
+	render.Template(w, r, "admin-two-factor.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	})
+}
+
+// newRecoveryCodes makes a set of recovery codes, keeping them in the session to show once, and
+// returns their hashes to store
+func (m *Repository) newRecoveryCodes(r *http.Request) ([]string, error) {
+	codes, err := totp.RecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+
+	m.App.Session.Put(r.Context(), "new_recovery_codes", strings.Join(codes, "\n"))
+	return hashes, nil
+}
+
+// AdminPostTwoFactor turns on two-factor authentication once the user enters a code from the new secret
+func (m *Repository) AdminPostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	secret := m.App.Session.GetString(r.Context(), "totp_setup_secret")
+	step, valid := totp.Verify(secret, r.Form.Get("code"), time.Now())
+	if secret == "" || !valid {
+		m.App.Session.Put(r.Context(), "error", "This code is not valid, check the time on your device and try again")
+		http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	hashes, err := m.newRecoveryCodes(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.EnableTOTP(user.ID, secret, step, hashes)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "totp_setup_secret")
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication is on")
+	http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+}
+
+// confirmSecondFactor checks the posted code of the logged in user before a change to their two-factor
+// settings. On failure it sends them back to the settings and returns false.
+func (m *Repository) confirmSecondFactor(w http.ResponseWriter, r *http.Request, user models.User) bool {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return false
+	}
+
+	ok, _, err := m.checkSecondFactor(user, r.Form.Get("code"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return false
+	}
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "This code is not valid")
+		http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+		return false
+	}
+
+	return true
+}
+
+// AdminRecoveryCodes replaces the recovery codes of the logged in user with new ones
+func (m *Repository) AdminRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok || !m.confirmSecondFactor(w, r, user) {
+		return
+	}
+
+	hashes, err := m.newRecoveryCodes(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ReplaceRecoveryCodes(user.ID, hashes)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "New recovery codes have been made, the old ones no longer work")
+	http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+}
+
+// AdminDisableTwoFactor turns off two-factor authentication for the logged in user, unless an owner
+// requires it of them
+func (m *Repository) AdminDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TOTPRequired {
+		m.App.Session.Put(r.Context(), "error", "Two-factor authentication is required for your account")
+		http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	if !m.confirmSecondFactor(w, r, user) {
+		return
+	}
+
+	err := m.DB.DisableTOTP(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication is off")
+	http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+}
+
+// AdminForgetTrustedDevices makes the logged in user enter a code at the next login on every browser
+func (m *Repository) AdminForgetTrustedDevices(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.DeleteTrustedDevices(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Trusted devices have been forgotten")
+	http.Redirect(w, r, "/admin/profile/two-factor", http.StatusSeeOther)
+}
+
+// AdminResetUserTwoFactor turns off two-factor authentication for a user who lost their device, so they
+// can log in with their password and set it up again. The user is signed out everywhere, so a session
+// on the lost device cannot be used any more.
+func (m *Repository) AdminResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DisableTOTP(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.signOutEverywhere(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash",
+		fmt.Sprintf("Two-factor authentication of %s %s has been reset", user.FirstName, user.LastName))
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/permission"
+	"bookings/internal/render"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// inviteLifetime is how long the link in an invitation email can be used to set a password
+const inviteLifetime = 7 * 24 * time.Hour
+
+// sendInvitation emails user a link to set their password, replacing any earlier invitation
+func (m *Repository) sendInvitation(user models.User) error {
+	token, err := m.newUserToken(user, models.UserTokenInvite, inviteLifetime)
+	if err != nil {
+		return err
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["link"] = m.passwordLink(models.UserTokenInvite, token)
+	stringMap["role"] = permission.RoleName(user.AccessLevel)
+
+	data := make(map[string]interface{})
+	data["user"] = user
+
+	m.sendEmail(m.newEmail(user.Email, "invitation", &models.EmailData{
+		Subject:   "You Have Been Invited",
+		StringMap: stringMap,
+		Data:      data,
+	}))
+
+	return nil
+}
+
+// isLastUserManager reports whether user is the only active user who can manage users, who must
+// keep that role so user management is not locked out
+func (m *Repository) isLastUserManager(user models.User) (bool, error) {
+	if !user.Active || !permission.Can(user.AccessLevel, permission.ManageUsers) {
+		return false, nil
+	}
+
+	users, err := m.DB.AllUsers()
+	if err != nil {
+		return false, err
+	}
+
+	for _, u := range users {
+		if u.ID != user.ID && u.Active && !u.Invited() && permission.Can(u.AccessLevel, permission.ManageUsers) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// AdminUsers lists the staff users
+func (m *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := m.DB.AllUsers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+
+	render.Template(w, r, "admin-users.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowUser renders the user form, an id of 0 means inviting a new user
+func (m *Repository) AdminShowUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	user := models.User{AccessLevel: permission.RoleFrontDesk, Active: true}
+	if userID > 0 {
+		user, err = m.DB.GetUserByID(userID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderUser(w, r, user, forms.New(nil))
+}
+
+// renderUser renders the user form with the given form errors
+func (m *Repository) renderUser(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) {
+	current, _ := helpers.CurrentUser(r)
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["roles"] = permission.Roles
+	data["self"] = user.ID == current.ID
+
+	render.Template(w, r, "admin-user.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostUser invites a new user or updates an existing one. Users cannot change their own role,
+// and the last active user who can manage users cannot be given a role without that permission.
+func (m *Repository) AdminPostUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	user := models.User{Active: true}
+	if userID > 0 {
+		user, err = m.DB.GetUserByID(userID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+	current, _ := helpers.CurrentUser(r)
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "access_level")
+	form.IsEmail("email")
+
+	user.FirstName = r.Form.Get("first_name")
+	user.LastName = r.Form.Get("last_name")
+	user.Email = r.Form.Get("email")
+	user.TOTPRequired = form.Has("totp_required")
+
+	level, _ := strconv.Atoi(r.Form.Get("access_level"))
+	if _, ok := permission.Lookup(level); !ok {
+		form.Errors.Add("access_level", "Choose a role")
+	} else if user.ID == current.ID && level != user.AccessLevel {
+		form.Errors.Add("access_level", "You cannot change your own role")
+	} else {
+		if user.ID > 0 && !permission.Can(level, permission.ManageUsers) {
+			last, err := m.isLastUserManager(user)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			if last {
+				form.Errors.Add("access_level", "This is the last user who can manage users, their role cannot be lowered")
+			}
+		}
+		user.AccessLevel = level
+	}
+
+	existing, err := m.DB.GetUserByEmail(user.Email)
+	if err == nil && existing.ID != user.ID {
+		form.Errors.Add("email", "This email address is already used by another user")
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		m.renderUser(w, r, user, form)
+		return
+	}
+
+	if userID > 0 {
+		err = m.auditDB(r).UpdateUser(user)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		m.App.Session.Put(r.Context(), "flash", "Changes saved")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	user.ID, err = m.auditDB(r).InsertUser(user)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.sendInvitation(user)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("An invitation has been sent to %s", user.Email))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminInviteUser sends a new invitation to a user who has not set a password yet
+func (m *Repository) AdminInviteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !user.Invited() {
+		m.App.Session.Put(r.Context(), "error", "This user has already set a password")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+		return
+	}
+
+	err = m.sendInvitation(user)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("A new invitation has been sent to %s", user.Email))
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+}
+
+// AdminDeactivateUser stops a user from logging in, without deleting what they did
+func (m *Repository) AdminDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	m.setUserActive(w, r, false)
+}
+
+// AdminActivateUser lets a deactivated user log in again
+func (m *Repository) AdminActivateUser(w http.ResponseWriter, r *http.Request) {
+	m.setUserActive(w, r, true)
+}
+
+// setUserActive activates or deactivates the user in the URL, who may not be the logged in user nor
+// the last user who can manage users. A deactivated user is signed out of all their sessions at once.
+func (m *Repository) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	current, _ := helpers.CurrentUser(r)
+	if userID == current.ID {
+		m.App.Session.Put(r.Context(), "error", "You cannot deactivate yourself")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !active {
+		last, err := m.isLastUserManager(user)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if last {
+			m.App.Session.Put(r.Context(), "error", "This is the last user who can manage users and cannot be deactivated")
+			http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+			return
+		}
+	}
+
+	user.Active = active
+	err = m.auditDB(r).UpdateUser(user)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !active {
+		err = m.signOutEverywhere(user.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if active {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s %s can log in again", user.FirstName, user.LastName))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s %s has been deactivated", user.FirstName, user.LastName))
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/permission"
+)
+
+// currentOwner is the logged in user of the user management tests, who is not one of the users changed
+var currentOwner = models.User{ID: 3, Active: true, AccessLevel: permission.RoleOwner}
+
+// adminPostUserTests is the data for the AdminPostUser handler tests, /admin/users/{id}
+var adminPostUserTests = []struct {
+	name               string
+	id                 int
+	accessLevel        int
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+}{
+	{
+		name:               "change-role",
+		id:                 2,
+		accessLevel:        permission.RoleReadOnly,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/users",
+	},
+	{
+		name:               "keep-role-of-last-owner",
+		id:                 1,
+		accessLevel:        permission.RoleOwner,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/users",
+	},
+	{
+		name:               "demote-last-owner",
+		id:                 1,
+		accessLevel:        permission.RoleManager,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This is the last user who can manage users",
+	},
+}
+
+// TestAdminPostUser tests the AdminPostUser handler
+func TestAdminPostUser(t *testing.T) {
+	for _, e := range adminPostUserTests {
+		postedData := url.Values{
+			"first_name":   {"Test"},
+			"last_name":    {"User"},
+			"email":        {fmt.Sprintf("user%d@here.ca", e.id)},
+			"access_level": {strconv.Itoa(e.accessLevel)},
+		}
+
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/users/%d", e.id), strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": strconv.Itoa(e.id)})
+		req = helpers.WithUser(req, currentOwner)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			if actualLoc := location(rr); actualLoc != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
+			}
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
+
+// adminDeactivateUserTests is the data for the AdminDeactivateUser handler tests, /admin/users/{id}/deactivate
+var adminDeactivateUserTests = []struct {
+	name             string
+	id               int
+	expectedLocation string
+	expectedError    string
+}{
+	{
+		name:             "deactivate",
+		id:               2,
+		expectedLocation: "/admin/users",
+	},
+	{
+		name:             "deactivate-last-owner",
+		id:               1,
+		expectedLocation: "/admin/users/1",
+		expectedError:    "This is the last user who can manage users and cannot be deactivated",
+	},
+	{
+		name:             "deactivate-yourself",
+		id:               currentOwner.ID,
+		expectedLocation: fmt.Sprintf("/admin/users/%d", currentOwner.ID),
+		expectedError:    "You cannot deactivate yourself",
+	},
+}
+
+// TestAdminDeactivateUser tests the AdminDeactivateUser handler
+func TestAdminDeactivateUser(t *testing.T) {
+	for _, e := range adminDeactivateUserTests {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/users/%d/deactivate", e.id), nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": strconv.Itoa(e.id)})
+		req = helpers.WithUser(req, currentOwner)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeactivateUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		if actualLoc := location(rr); actualLoc != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc)
+		}
+
+		if actualError := session.GetString(ctx, "error"); actualError != e.expectedError {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, actualError)
+		}
+	}
+}
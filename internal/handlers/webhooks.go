@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bookings/internal/forms"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
+	"bookings/internal/render"
+	"bookings/internal/webhooks"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookLogSize is the number of recent deliveries shown for a webhook
+const webhookLogSize = 50
+
+// reservationEvent builds the webhook message of a reservation event. The repository calls it with
+// the reservation as the change saved it and queues the message in the transaction of the change.
+func reservationEvent(event string) func(res models.Reservation) (models.WebhookMessage, error) {
+	return func(res models.Reservation) (models.WebhookMessage, error) {
+		return webhooks.NewMessage(event, apiReservation(res))
+	}
+}
+
+// webhookFromForm reads the URL, events and secret of a webhook form, validating them into form
+func webhookFromForm(r *http.Request, form *forms.Form, hook *models.Webhook) {
+	form.Required("url")
+	form.IsURL("url")
+
+	hook.URL = strings.TrimSpace(r.Form.Get("url"))
+
+	hook.Events = nil
+	for _, e := range r.Form["events"] {
+		for _, known := range models.WebhookEvents {
+			if e == known {
+				hook.Events = append(hook.Events, e)
+			}
+		}
+	}
+	if len(hook.Events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+
+	// a blank secret keeps the current one
+	if secret := strings.TrimSpace(r.Form.Get("secret")); secret != "" {
+		hook.Secret = secret
+	}
+}
+
+// newWebhookSecret returns a random secret for signing payloads
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AdminWebhooks lists the webhooks with a form to add one
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	m.renderWebhooks(w, r, forms.New(nil))
+}
+
+// renderWebhooks renders the webhooks page with the given new webhook form
+func (m *Repository) renderWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	hooks, err := m.DB.AllWebhooks()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhooks"] = hooks
+	data["events"] = models.WebhookEvents
+
+	render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostWebhook adds a webhook
+func (m *Repository) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	hook := models.Webhook{Active: true}
+	webhookFromForm(r, form, &hook)
+
+	if !form.Valid() {
+		m.renderWebhooks(w, r, form)
+		return
+	}
+
+	if hook.Secret == "" {
+		hook.Secret, err = newWebhookSecret()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	hook.ID, err = m.auditDB(r).InsertWebhook(hook)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+// AdminShowWebhook shows a webhook with its recent deliveries
+func (m *Repository) AdminShowWebhook(w http.ResponseWriter, r *http.Request) {
+	hookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	hook, err := m.DB.GetWebhookByID(hookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderWebhook(w, r, hook, forms.New(nil))
+}
+
+// renderWebhook renders the page of a webhook with the given edit form
+func (m *Repository) renderWebhook(w http.ResponseWriter, r *http.Request, hook models.Webhook, form *forms.Form) {
+	deliveries, err := m.DB.WebhookDeliveries(hook.ID, webhookLogSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhook"] = hook
+	data["deliveries"] = deliveries
+	data["events"] = models.WebhookEvents
+
+	render.Template(w, r, "admin-webhook.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminUpdateWebhook saves changes to a webhook
+func (m *Repository) AdminUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	hookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	hook, err := m.DB.GetWebhookByID(hookID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	webhookFromForm(r, form, &hook)
+	hook.Active = r.Form.Get("active") == "1"
+
+	if !form.Valid() {
+		m.renderWebhook(w, r, hook, form)
+		return
+	}
+
+	err = m.auditDB(r).UpdateWebhook(hook)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+// AdminDeleteWebhook deletes a webhook and its delivery log
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.auditDB(r).DeleteWebhook(hookID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminRetryWebhookDelivery queues a failed delivery again
+func (m *Repository) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	hookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.RetryWebhookDelivery(deliveryID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Delivery queued again")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hookID), http.StatusSeeOther)
+}
@@ -2,14 +2,24 @@ package helpers
 
 import (
 	"bookings/internal/config"
+	"bookings/internal/models"
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 )
 
 var app *config.AppConfig
 
+// contextKey is the type of the request context keys set by this package
+type contextKey string
+
+// userKey holds the logged in user in the request context
+const userKey contextKey = "user"
+
 // NewHelpers sets up app config for helpers
 func NewHelpers(a *config.AppConfig) {
 	app = a
@@ -49,6 +59,51 @@ func FormatDate(t time.Time, f string) string {
 	return t.Format(f)
 }
 
+// ClientIP returns the IP address the request came from. X-Forwarded-For is only read when the
+// request comes from a trusted proxy, and is walked from the right so a visitor cannot forge it.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(host) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether addr belongs to one of the configured trusted proxies
+func trustedProxy(addr string) bool {
+	if app == nil {
+		return false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range app.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func IsAuthenticated(r *http.Request) bool {
 	return app.Session.Exists(r.Context(), "user_id")
 }
@@ -67,3 +122,26 @@ func Iterate(count int) []int {
 func Add(a, b int) int {
 	return a + b
 }
+
+// SplitLines turns newline separated text, such as a textarea value, into a list, dropping blank lines
+func SplitLines(s string) []string {
+	var items []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// WithUser returns a copy of r carrying the logged in user
+func WithUser(r *http.Request, user models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, user))
+}
+
+// CurrentUser returns the logged in user, loaded by the Auth middleware
+func CurrentUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(userKey).(models.User)
+	return user, ok
+}
@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"bookings/internal/config"
+)
+
+// clientIPTests is the data for the ClientIP tests, with 10.0.0.0/8 as the trusted proxies
+var clientIPTests = []struct {
+	name         string
+	remoteAddr   string
+	forwardedFor []string
+	expectedIP   string
+}{
+	{
+		name:       "direct",
+		remoteAddr: "203.0.113.7:1234",
+		expectedIP: "203.0.113.7",
+	},
+	{
+		name:         "forged-header-from-untrusted",
+		remoteAddr:   "203.0.113.7:1234",
+		forwardedFor: []string{"198.51.100.1"},
+		expectedIP:   "203.0.113.7",
+	},
+	{
+		name:         "through-trusted-proxy",
+		remoteAddr:   "10.0.0.2:1234",
+		forwardedFor: []string{"198.51.100.1"},
+		expectedIP:   "198.51.100.1",
+	},
+	{
+		name:         "forged-entry-before-visitor",
+		remoteAddr:   "10.0.0.2:1234",
+		forwardedFor: []string{"192.0.2.9, 198.51.100.1"},
+		expectedIP:   "198.51.100.1",
+	},
+	{
+		name:         "chain-of-trusted-proxies",
+		remoteAddr:   "10.0.0.2:1234",
+		forwardedFor: []string{"198.51.100.1, 10.0.0.3", "10.0.0.4"},
+		expectedIP:   "198.51.100.1",
+	},
+	{
+		name:         "malformed-entry",
+		remoteAddr:   "10.0.0.2:1234",
+		forwardedFor: []string{"fish, 10.0.0.3"},
+		expectedIP:   "10.0.0.3",
+	},
+	{
+		name:       "trusted-proxy-without-header",
+		remoteAddr: "10.0.0.2:1234",
+		expectedIP: "10.0.0.2",
+	},
+}
+
+// TestClientIP tests that X-Forwarded-For is only read from trusted proxies
+func TestClientIP(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	app = &config.AppConfig{TrustedProxies: []*net.IPNet{network}}
+	defer func() { app = nil }()
+
+	for _, e := range clientIPTests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		for _, header := range e.forwardedFor {
+			req.Header.Add("X-Forwarded-For", header)
+		}
+
+		if ip := ClientIP(req); ip != e.expectedIP {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expectedIP, ip)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Calendar methods used in email attachments
+const (
+	MethodPublish = "PUBLISH"
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+// ContentType is the MIME type of iCalendar data
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineLength is the number of octets after which content lines are folded
+const maxLineLength = 75
+
+// Event is a VEVENT component
+type Event struct {
+	UID         string
+	Sequence    int
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	// AllDay writes Start and End as dates, End being the day after the last day
+	AllDay    bool
+	Cancelled bool
+	Organizer string
+	Attendee  string
+}
+
+// Calendar is a VCALENDAR object
+type Calendar struct {
+	ProdID string
+	Method string
+	Name   string
+	Events []Event
+}
+
+// WriteTo writes the calendar in RFC 5545 format, stamping events with the current time
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	return c.write(w, time.Now())
+}
+
+// Bytes returns the calendar in RFC 5545 format
+func (c *Calendar) Bytes() []byte {
+	var buf bytes.Buffer
+	_, _ = c.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+func (c *Calendar) write(w io.Writer, now time.Time) (int64, error) {
+	lw := &lineWriter{w: w}
+
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + c.ProdID)
+	lw.line("CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		lw.line("METHOD:" + c.Method)
+	}
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		lw.line("BEGIN:VEVENT")
+		lw.line("UID:" + e.UID)
+		lw.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		lw.line("DTSTAMP:" + utc(now))
+		if e.AllDay {
+			lw.line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			lw.line("DTEND;VALUE=DATE:" + e.End.Format("20060102"))
+		} else {
+			lw.line("DTSTART:" + utc(e.Start))
+			lw.line("DTEND:" + utc(e.End))
+		}
+		lw.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			lw.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			lw.line("LOCATION:" + escape(e.Location))
+		}
+		if e.Organizer != "" {
+			lw.line("ORGANIZER:mailto:" + e.Organizer)
+		}
+		if e.Attendee != "" {
+			lw.line("ATTENDEE;ROLE=REQ-PARTICIPANT;RSVP=FALSE:mailto:" + e.Attendee)
+		}
+		if e.Cancelled {
+			lw.line("STATUS:CANCELLED")
+		} else {
+			lw.line("STATUS:CONFIRMED")
+		}
+		lw.line("TRANSP:OPAQUE")
+		lw.line("END:VEVENT")
+	}
+
+	lw.line("END:VCALENDAR")
+
+	return lw.n, lw.err
+}
+
+// utc formats a time in the UTC date-time form
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape escapes a TEXT property value
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
+
+// lineWriter writes CRLF terminated content lines, folding long lines and keeping the first error
+type lineWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	length := 0
+	for _, r := range s {
+		size := len(string(r))
+		if length+size > maxLineLength {
+			// continuation lines start with a space, which counts towards their length
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	b.WriteString("\r\n")
+
+	n, err := io.WriteString(lw.w, b.String())
+	lw.n += int64(n)
+	lw.err = err
+}
@@ -0,0 +1,90 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar_Write(t *testing.T) {
+	c := Calendar{
+		ProdID: "-//Fort Smyth//Bookings//EN",
+		Method: MethodCancel,
+		Events: []Event{
+			{
+				UID:       "reservation-1@fortsmyth",
+				Sequence:  2,
+				Summary:   "Stay; General's Quarters, Fort Smyth",
+				Location:  "1 Main Street\nFort Smyth",
+				Start:     time.Date(2050, 1, 1, 15, 0, 0, 0, time.FixedZone("AST", -4*3600)),
+				End:       time.Date(2050, 1, 3, 11, 0, 0, 0, time.FixedZone("AST", -4*3600)),
+				Cancelled: true,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	now := time.Date(2049, 12, 1, 8, 0, 0, 0, time.UTC)
+	_, err := c.write(&buf, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"METHOD:CANCEL\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTAMP:20491201T080000Z\r\n",
+		"DTSTART:20500101T190000Z\r\n",
+		"DTEND:20500103T150000Z\r\n",
+		`SUMMARY:Stay\; General's Quarters\, Fort Smyth` + "\r\n",
+		`LOCATION:1 Main Street\nFort Smyth` + "\r\n",
+		"STATUS:CANCELLED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCalendar_AllDay(t *testing.T) {
+	c := Calendar{
+		ProdID: "-//Fort Smyth//Bookings//EN",
+		Events: []Event{
+			{
+				UID:    "block-1@fortsmyth",
+				AllDay: true,
+				Start:  time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+				End:    time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	out := string(c.Bytes())
+	if !strings.Contains(out, "DTSTART;VALUE=DATE:20500101\r\n") || !strings.Contains(out, "DTEND;VALUE=DATE:20500102\r\n") {
+		t.Errorf("expected date values in:\n%s", out)
+	}
+	if strings.Contains(out, "METHOD:") {
+		t.Error("no METHOD expected when none is set")
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	lw := &lineWriter{w: &buf}
+	lw.line("DESCRIPTION:" + strings.Repeat("é", 100))
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(buf.String(), "\r\n ", "")
+	if unfolded != "DESCRIPTION:"+strings.Repeat("é", 100)+"\r\n" {
+		t.Errorf("unfolding did not restore the line: %q", unfolded)
+	}
+}
@@ -0,0 +1,209 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned by Parse when the data holds no VCALENDAR
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+// property is a parsed content line
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the VEVENT components of an iCalendar file. Events without a UID or DTSTART are
+// skipped, a missing DTEND is taken as one day (or no time) after DTSTART.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var hasEnd, isCalendar bool
+
+	for _, line := range lines {
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VCALENDAR"):
+			isCalendar = true
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			current = &Event{}
+			hasEnd = false
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if current != nil && current.UID != "" && !current.Start.IsZero() {
+				if !hasEnd {
+					current.End = current.Start
+					if current.AllDay {
+						current.End = current.Start.AddDate(0, 0, 1)
+					}
+				}
+				events = append(events, *current)
+			}
+			current = nil
+		case current != nil:
+			err := current.set(p, &hasEnd)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !isCalendar {
+		return nil, ErrNotCalendar
+	}
+
+	return events, nil
+}
+
+// set applies a property to the event
+func (e *Event) set(p property, hasEnd *bool) error {
+	switch p.name {
+	case "UID":
+		e.UID = p.value
+	case "SUMMARY":
+		e.Summary = unescape(p.value)
+	case "DESCRIPTION":
+		e.Description = unescape(p.value)
+	case "LOCATION":
+		e.Location = unescape(p.value)
+	case "SEQUENCE":
+		e.Sequence, _ = strconv.Atoi(p.value)
+	case "STATUS":
+		e.Cancelled = strings.EqualFold(p.value, "CANCELLED")
+	case "DTSTART":
+		t, allDay, err := parseTime(p)
+		if err != nil {
+			return err
+		}
+		e.Start, e.AllDay = t, allDay
+	case "DTEND":
+		t, _, err := parseTime(p)
+		if err != nil {
+			return err
+		}
+		e.End = t
+		*hasEnd = true
+	}
+	return nil
+}
+
+// unfold reads content lines, joining folded continuation lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into its name, parameters and value
+func parseLine(line string) (property, bool) {
+	colon := -1
+	inQuotes := false
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p := property{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		k, v, found := strings.Cut(param, "=")
+		if found {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+
+	return p, true
+}
+
+// parseTime reads a DATE or DATE-TIME value, reporting whether it is a date
+func parseTime(p property) (time.Time, bool, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == 8 {
+		t, err := time.Parse("20060102", p.value)
+		if err != nil {
+			return t, true, fmt.Errorf("invalid %s %q", p.name, p.value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse("20060102T150405Z", p.value)
+		if err != nil {
+			return t, false, fmt.Errorf("invalid %s %q", p.name, p.value)
+		}
+		return t, false, nil
+	}
+
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", p.value, loc)
+	if err != nil {
+		return t, false, fmt.Errorf("invalid %s %q", p.name, p.value)
+	}
+	return t, false, nil
+}
+
+// unescape reverses escape
+func unescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			switch r {
+			case 'n', 'N':
+				b.WriteRune('\n')
+			default:
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
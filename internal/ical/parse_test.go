@@ -0,0 +1,101 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+const airbnbFeed = "BEGIN:VCALENDAR\r\n" +
+	"PRODID:-//Other Site//Hosting Calendar//EN\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20500110\r\n" +
+	"DTEND;VALUE=DATE:20500113\r\n" +
+	"UID:abc-123@othersite.com\r\n" +
+	"SUMMARY:Reserved\\, thanks\r\n" +
+	"DESCRIPTION:A long description that has been folded over more than one line by\r\n" +
+	"  the server\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;TZID=America/Halifax:20500201T150000\r\n" +
+	"DTEND;TZID=America/Halifax:20500203T110000\r\n" +
+	"UID:def-456@othersite.com\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20500301\r\n" +
+	"UID:ghi-789@othersite.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:No uid, skipped\r\n" +
+	"DTSTART;VALUE=DATE:20500401\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(airbnbFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	first := events[0]
+	if first.UID != "abc-123@othersite.com" || !first.AllDay {
+		t.Errorf("unexpected first event %+v", first)
+	}
+	if !first.Start.Equal(time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)) || !first.End.Equal(time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong dates %s - %s", first.Start, first.End)
+	}
+	if first.Summary != "Reserved, thanks" {
+		t.Errorf("summary not unescaped: %q", first.Summary)
+	}
+	if !strings.HasSuffix(first.Description, "by the server") {
+		t.Errorf("folded description not joined: %q", first.Description)
+	}
+
+	second := events[1]
+	if !second.Cancelled || second.AllDay {
+		t.Errorf("expected a cancelled timed event, got %+v", second)
+	}
+	if second.Start.UTC().Hour() != 19 {
+		t.Errorf("expected TZID to be applied, got %s", second.Start.UTC())
+	}
+
+	third := events[2]
+	if !third.End.Equal(time.Date(2050, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a missing DTEND to last one day, got %s", third.End)
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	c := Calendar{
+		ProdID: "-//Fort Smyth//Bookings//EN",
+		Events: []Event{{
+			UID:     "restriction-1@fortsmyth",
+			Summary: "Blocked; owner, " + strings.Repeat("x", 80),
+			Start:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			AllDay:  true,
+		}},
+	}
+
+	events, err := Parse(strings.NewReader(string(c.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != c.Events[0].Summary || !events[0].End.Equal(c.Events[0].End) {
+		t.Errorf("round trip changed the event: %+v", events)
+	}
+}
+
+func TestParse_NotCalendar(t *testing.T) {
+	_, err := Parse(strings.NewReader("<html><body>Not found</body></html>"))
+	if err != ErrNotCalendar {
+		t.Errorf("expected ErrNotCalendar, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package icalsync
+
+import (
+	"bookings/internal/ical"
+	"bookings/internal/models"
+	"bookings/internal/repository"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// RestrictionExternal is the restrictions row of events imported from other calendars
+const RestrictionExternal = 3
+
+// maxFeedSize limits how much of a feed is read
+const maxFeedSize = 5 << 20
+
+// Feed statuses
+const (
+	StatusOK      = "ok"
+	StatusWarning = "warning"
+	StatusError   = "error"
+)
+
+// Store is the part of the database repository used by the syncer
+type Store interface {
+	AllICalFeeds() ([]models.ICalFeed, error)
+	UpdateICalFeedStatus(feed models.ICalFeed) error
+	GetExternalRestrictions(feedID int) ([]models.RoomRestriction, error)
+	InsertExternalRestriction(r models.RoomRestriction) error
+	UpdateExternalRestriction(r models.RoomRestriction) error
+	DeleteRoomRestrictionByID(id int) error
+}
+
+// Result counts the changes made by syncing a feed
+type Result struct {
+	Events  int
+	Added   int
+	Updated int
+	Removed int
+	// Conflicts are events skipped because the room is already taken on their dates
+	Conflicts int
+}
+
+// Syncer imports the events of external calendars as room restrictions
+type Syncer struct {
+	DB       Store
+	Client   *http.Client
+	ErrorLog *log.Logger
+}
+
+// NewSyncer creates a new syncer
+func NewSyncer(db Store, errorLog *log.Logger) *Syncer {
+	return &Syncer{
+		DB:       db,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		ErrorLog: errorLog,
+	}
+}
+
+// Start syncs all feeds every interval until done is closed
+func (s *Syncer) Start(interval time.Duration, done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			err := s.SyncAll()
+			if err != nil {
+				s.ErrorLog.Println(err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// SyncAll syncs every feed. Errors of single feeds are recorded on the feed, only failures to
+// read the feeds are returned.
+func (s *Syncer) SyncAll() error {
+	feeds, err := s.DB.AllICalFeeds()
+	if err != nil {
+		return err
+	}
+
+	for _, feed := range feeds {
+		_, err := s.SyncFeed(feed)
+		if err != nil {
+			s.ErrorLog.Printf("syncing calendar %q of room %d: %v", feed.Name, feed.RoomID, err)
+		}
+	}
+
+	return nil
+}
+
+// SyncFeed fetches a feed and makes its room's external restrictions match the feed's events,
+// then records the outcome on the feed
+func (s *Syncer) SyncFeed(feed models.ICalFeed) (Result, error) {
+	result, err := s.sync(feed, time.Now())
+
+	feed.LastSyncedAt = time.Now()
+	feed.EventCount = result.Events
+	switch {
+	case err != nil:
+		feed.LastStatus = StatusError
+		feed.LastError = err.Error()
+	case result.Conflicts > 0:
+		feed.LastStatus = StatusWarning
+		feed.LastError = fmt.Sprintf("%d events overlap bookings of this room and were skipped", result.Conflicts)
+	default:
+		feed.LastStatus = StatusOK
+		feed.LastError = ""
+	}
+
+	statusErr := s.DB.UpdateICalFeedStatus(feed)
+	if err != nil {
+		return result, err
+	}
+
+	return result, statusErr
+}
+
+// sync applies the difference between the feed's events and the restrictions imported before,
+// matching them by UID. Events that ended before now are left out.
+func (s *Syncer) sync(feed models.ICalFeed, now time.Time) (Result, error) {
+	var result Result
+
+	events, err := s.fetch(feed.URL)
+	if err != nil {
+		return result, err
+	}
+
+	existing, err := s.DB.GetExternalRestrictions(feed.ID)
+	if err != nil {
+		return result, err
+	}
+
+	imported := make(map[string]models.RoomRestriction)
+	for _, r := range existing {
+		imported[r.ExternalUID] = r
+	}
+
+	today := dateOf(now)
+	seen := make(map[string]bool)
+
+	for _, e := range events {
+		if e.Cancelled || seen[e.UID] {
+			continue
+		}
+
+		start, end := dateOf(e.Start), dateOf(e.End)
+		if !end.After(start) {
+			end = start.AddDate(0, 0, 1)
+		}
+		if !end.After(today) {
+			continue
+		}
+
+		seen[e.UID] = true
+		result.Events++
+
+		r, ok := imported[e.UID]
+		switch {
+		case !ok:
+			err = s.DB.InsertExternalRestriction(models.RoomRestriction{
+				RoomID:        feed.RoomID,
+				RestrictionID: RestrictionExternal,
+				StartDate:     start,
+				EndDate:       end,
+				ICalFeedID:    feed.ID,
+				ExternalUID:   e.UID,
+			})
+			if err == nil {
+				result.Added++
+			}
+		case !r.StartDate.Equal(start) || !r.EndDate.Equal(end):
+			r.StartDate, r.EndDate = start, end
+			err = s.DB.UpdateExternalRestriction(r)
+			if err == nil {
+				result.Updated++
+			}
+		}
+
+		if errors.Is(err, repository.ErrRoomNotAvailable) {
+			result.Conflicts++
+		} else if err != nil {
+			return result, err
+		}
+	}
+
+	for uid, r := range imported {
+		if seen[uid] {
+			continue
+		}
+		err = s.DB.DeleteRoomRestrictionByID(r.ID)
+		if err != nil {
+			return result, err
+		}
+		result.Removed++
+	}
+
+	return result, nil
+}
+
+// fetch downloads and parses a feed
+func (s *Syncer) fetch(url string) ([]ical.Event, error) {
+	resp, err := s.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar server answered %s", resp.Status)
+	}
+
+	return ical.Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// dateOf returns the calendar day of t in its own time zone
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
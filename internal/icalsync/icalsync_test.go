@@ -0,0 +1,151 @@
+package icalsync
+
+import (
+	"bookings/internal/models"
+	"bookings/internal/repository"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	restrictions []models.RoomRestriction
+	nextID       int
+	// taken is a date on which the room is already booked
+	taken  time.Time
+	status models.ICalFeed
+}
+
+func (s *fakeStore) AllICalFeeds() ([]models.ICalFeed, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) UpdateICalFeedStatus(feed models.ICalFeed) error {
+	s.status = feed
+	return nil
+}
+
+func (s *fakeStore) GetExternalRestrictions(feedID int) ([]models.RoomRestriction, error) {
+	return append([]models.RoomRestriction(nil), s.restrictions...), nil
+}
+
+func (s *fakeStore) InsertExternalRestriction(r models.RoomRestriction) error {
+	if !s.taken.Before(r.StartDate) && s.taken.Before(r.EndDate) {
+		return repository.ErrRoomNotAvailable
+	}
+	s.nextID++
+	r.ID = s.nextID
+	s.restrictions = append(s.restrictions, r)
+	return nil
+}
+
+func (s *fakeStore) UpdateExternalRestriction(r models.RoomRestriction) error {
+	for i := range s.restrictions {
+		if s.restrictions[i].ID == r.ID {
+			s.restrictions[i] = r
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) DeleteRoomRestrictionByID(id int) error {
+	for i := range s.restrictions {
+		if s.restrictions[i].ID == id {
+			s.restrictions = append(s.restrictions[:i], s.restrictions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func event(uid, start, end string) string {
+	return fmt.Sprintf("BEGIN:VEVENT\r\nUID:%s\r\nDTSTART;VALUE=DATE:%s\r\nDTEND;VALUE=DATE:%s\r\nSUMMARY:Reserved\r\nEND:VEVENT\r\n",
+		uid, start, end)
+}
+
+func TestSyncer_SyncFeed(t *testing.T) {
+	body := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		fmt.Fprint(w, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"+body+"END:VCALENDAR\r\n")
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{taken: date("2050-03-02")}
+	s := NewSyncer(store, log.New(io.Discard, "", 0))
+	feed := models.ICalFeed{ID: 7, RoomID: 1, Name: "Other site", URL: srv.URL}
+
+	// first sync imports two events, the third overlaps a booking and the fourth is in the past
+	body = event("a", "20500101", "20500104") + event("b", "20500201", "20500203") +
+		event("c", "20500301", "20500305") + event("old", "20000101", "20000102")
+
+	result, err := s.SyncFeed(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 2 || result.Conflicts != 1 || result.Events != 3 {
+		t.Errorf("unexpected first result %+v", result)
+	}
+	if store.status.LastStatus != StatusWarning || store.status.EventCount != 3 {
+		t.Errorf("expected a warning for the overlapping event, got %+v", store.status)
+	}
+	if store.restrictions[0].RestrictionID != RestrictionExternal || store.restrictions[0].ICalFeedID != 7 {
+		t.Errorf("restriction not marked as external: %+v", store.restrictions[0])
+	}
+
+	// second sync moves a, drops b and adds d
+	body = event("a", "20500102", "20500104") + event("d", "20500401", "20500402")
+
+	result, err = s.SyncFeed(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 1 || result.Updated != 1 || result.Removed != 1 || result.Conflicts != 0 {
+		t.Errorf("unexpected second result %+v", result)
+	}
+	if store.status.LastStatus != StatusOK || store.status.LastError != "" {
+		t.Errorf("expected an ok status, got %+v", store.status)
+	}
+
+	if len(store.restrictions) != 2 {
+		t.Fatalf("expected 2 restrictions, got %d", len(store.restrictions))
+	}
+	for _, r := range store.restrictions {
+		if r.ExternalUID == "a" && !r.StartDate.Equal(date("2050-01-02")) {
+			t.Errorf("event a was not moved: %+v", r)
+		}
+		if r.ExternalUID == "b" {
+			t.Error("event b should have been removed")
+		}
+	}
+}
+
+func TestSyncer_SyncFeedError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{restrictions: []models.RoomRestriction{{ID: 1, ExternalUID: "a"}}}
+	s := NewSyncer(store, log.New(io.Discard, "", 0))
+
+	_, err := s.SyncFeed(models.ICalFeed{ID: 1, RoomID: 1, URL: srv.URL})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if store.status.LastStatus != StatusError || store.status.LastError == "" {
+		t.Errorf("expected the error to be recorded, got %+v", store.status)
+	}
+	if len(store.restrictions) != 1 {
+		t.Error("restrictions must be kept when the feed cannot be read")
+	}
+}
@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"bookings/internal/models"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg models.MailData) error
+}
+
+// Encryption modes accepted by SMTPConfig
+const (
+	EncryptionNone     = "none"
+	EncryptionSSL      = "ssl"
+	EncryptionSTARTTLS = "starttls"
+)
+
+// SMTPConfig holds the settings of the outgoing mail server
+type SMTPConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Encryption string
+}
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	Config     SMTPConfig
+	encryption mail.Encryption
+}
+
+// NewSMTP creates a new SMTP mailer, checking the encryption mode
+func NewSMTP(cfg SMTPConfig) (*SMTPMailer, error) {
+	encryption, err := parseEncryption(cfg.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMTPMailer{
+		Config:     cfg,
+		encryption: encryption,
+	}, nil
+}
+
+// parseEncryption maps an encryption mode to the setting of the mail client
+func parseEncryption(mode string) (mail.Encryption, error) {
+	switch strings.ToLower(mode) {
+	case "", EncryptionNone:
+		return mail.EncryptionNone, nil
+	case EncryptionSSL:
+		return mail.EncryptionSSLTLS, nil
+	case EncryptionSTARTTLS:
+		return mail.EncryptionSTARTTLS, nil
+	}
+	return mail.EncryptionNone, fmt.Errorf("unknown smtp encryption %q, use none, ssl or starttls", mode)
+}
+
+// Send connects to the server and delivers a single message
+func (s *SMTPMailer) Send(m models.MailData) error {
+	server := mail.NewSMTPClient()
+	server.Host = s.Config.Host
+	server.Port = s.Config.Port
+	server.Username = s.Config.Username
+	server.Password = s.Config.Password
+	server.Encryption = s.encryption
+	server.KeepAlive = false
+	server.ConnectTimeout = 10 * time.Second
+	server.SendTimeout = 10 * time.Second
+
+	client, err := server.Connect()
+	if err != nil {
+		return err
+	}
+
+	email := mail.NewMSG()
+	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
+	email.SetBody(mail.TextHTML, m.Content)
+	if m.PlainText != "" {
+		email.AddAlternative(mail.TextPlain, m.PlainText)
+	}
+	for _, a := range m.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.ContentType, Data: a.Data})
+	}
+
+	return email.Send(client)
+}
+
+// RecordingMailer keeps sent messages in memory instead of delivering them, for use in tests
+type RecordingMailer struct {
+	// Err, when set, is returned by Send and the message is not recorded
+	Err  error
+	mu   sync.Mutex
+	sent []models.MailData
+}
+
+// NewRecording creates a new recording mailer
+func NewRecording() *RecordingMailer {
+	return &RecordingMailer{}
+}
+
+// Send records the message
+func (r *RecordingMailer) Send(msg models.MailData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Err != nil {
+		return r.Err
+	}
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+// Sent returns the messages recorded so far
+func (r *RecordingMailer) Sent() []models.MailData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.MailData(nil), r.sent...)
+}
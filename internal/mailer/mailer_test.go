@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"bookings/internal/models"
+	"errors"
+	"testing"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+func TestNewSMTP(t *testing.T) {
+	var tests = []struct {
+		mode     string
+		expected mail.Encryption
+		isValid  bool
+	}{
+		{"", mail.EncryptionNone, true},
+		{"none", mail.EncryptionNone, true},
+		{"SSL", mail.EncryptionSSLTLS, true},
+		{"starttls", mail.EncryptionSTARTTLS, true},
+		{"tls13", mail.EncryptionNone, false},
+	}
+
+	for _, e := range tests {
+		m, err := NewSMTP(SMTPConfig{Host: "localhost", Port: 1025, Encryption: e.mode})
+		if !e.isValid {
+			if err == nil {
+				t.Errorf("%q: expected an error", e.mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", e.mode, err)
+			continue
+		}
+		if m.encryption != e.expected {
+			t.Errorf("%q: expected encryption %v but got %v", e.mode, e.expected, m.encryption)
+		}
+	}
+}
+
+func TestRecordingMailer(t *testing.T) {
+	r := NewRecording()
+
+	err := r.Send(models.MailData{To: "you@there.com", Subject: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Err = errors.New("mail server down")
+	err = r.Send(models.MailData{To: "other@there.com"})
+	if err == nil {
+		t.Error("expected the configured error")
+	}
+
+	sent := r.Sent()
+	if len(sent) != 1 || sent[0].To != "you@there.com" {
+		t.Errorf("expected only the first message to be recorded, got %v", sent)
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// API token scopes. A write token can also read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Allows reports whether the token may be used for a request needing scope at time now
+func (t APIToken) Allows(scope string, now time.Time) bool {
+	if !now.Before(t.ExpiresAt) {
+		return false
+	}
+
+	switch scope {
+	case ScopeRead:
+		return t.Scope == ScopeRead || t.Scope == ScopeWrite
+	case ScopeWrite:
+		return t.Scope == ScopeWrite
+	}
+	return false
+}
+
+// One-time user token purposes
+const (
+	// UserTokenInvite is the purpose of the link inviting a new user to set their password
+	UserTokenInvite = "invite"
+	// UserTokenReset is the purpose of the link a user asks for to reset a forgotten password
+	UserTokenReset = "reset"
+)
+
+// Invited reports whether the user was invited but has not set a password yet
+func (u User) Invited() bool {
+	return u.Password == ""
+}
+
+// TwoFactorEnabled reports whether the user has set up two-factor authentication
+func (u User) TwoFactorEnabled() bool {
+	return u.TOTPSecret != ""
+}
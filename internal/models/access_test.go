@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPITokenAllows(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	read := APIToken{Scope: ScopeRead, ExpiresAt: now.Add(time.Hour)}
+	write := APIToken{Scope: ScopeWrite, ExpiresAt: now.Add(time.Hour)}
+
+	if !read.Allows(ScopeRead, now) {
+		t.Error("read token should allow reading")
+	}
+	if read.Allows(ScopeWrite, now) {
+		t.Error("read token should not allow writing")
+	}
+	if !write.Allows(ScopeRead, now) || !write.Allows(ScopeWrite, now) {
+		t.Error("write token should allow reading and writing")
+	}
+	if write.Allows(ScopeWrite, now.Add(time.Hour)) {
+		t.Error("expired token should not be allowed")
+	}
+	if write.Allows("admin", now) {
+		t.Error("unknown scope should not be allowed")
+	}
+}
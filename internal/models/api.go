@@ -0,0 +1,76 @@
+package models
+
+// APIRoom is a room in API responses
+type APIRoom struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Description string   `json:"description"`
+	Capacity    int      `json:"capacity"`
+	Amenities   []string `json:"amenities"`
+	Images      []string `json:"images"`
+	// NightlyRate is the base rate in cents
+	NightlyRate int `json:"nightly_rate"`
+}
+
+// APIAvailableRoom is a room that can be booked for the requested dates, with the price of the stay
+type APIAvailableRoom struct {
+	Room APIRoom `json:"room"`
+	// TotalPrice is the price of the whole stay in cents
+	TotalPrice int `json:"total_price"`
+}
+
+// APIAvailability answers an availability query
+type APIAvailability struct {
+	StartDate string             `json:"start_date" format:"date"`
+	EndDate   string             `json:"end_date" format:"date"`
+	Rooms     []APIAvailableRoom `json:"rooms"`
+}
+
+// APIReservationRequest is the body of a request creating a reservation
+type APIReservationRequest struct {
+	RoomID    int    `json:"room_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone,omitempty"`
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+}
+
+// APIReservation is a reservation in API responses
+type APIReservation struct {
+	ID        int    `json:"id"`
+	RoomID    int    `json:"room_id"`
+	RoomName  string `json:"room_name"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+	Status    string `json:"status"`
+	// TotalPrice and CancellationFee are in cents
+	TotalPrice      int            `json:"total_price"`
+	CancellationFee int            `json:"cancellation_fee"`
+	PriceLines      []APIPriceLine `json:"price_lines"`
+}
+
+// APIPriceLine is the price of one night of a reservation, in cents
+type APIPriceLine struct {
+	Date        string `json:"date" format:"date"`
+	Description string `json:"description"`
+	Amount      int    `json:"amount"`
+}
+
+// APIError is the body of every failed API request
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+// APIErrorDetail describes what went wrong. Fields lists the problems of invalid request fields.
+type APIErrorDetail struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
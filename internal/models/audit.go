@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// Audited entities
+const (
+	AuditEntityReservation  = "reservation"
+	AuditEntityRoom         = "room"
+	AuditEntitySeasonalRate = "seasonal_rate"
+	AuditEntityStayRule     = "stay_rule"
+	AuditEntityUser         = "user"
+	AuditEntityWebhook      = "webhook"
+	AuditEntityICalFeed     = "ical_feed"
+)
+
+// AuditEntities are the audited entities, in the order the audit filter offers them
+var AuditEntities = []string{
+	AuditEntityReservation,
+	AuditEntityRoom,
+	AuditEntitySeasonalRate,
+	AuditEntityStayRule,
+	AuditEntityUser,
+	AuditEntityWebhook,
+	AuditEntityICalFeed,
+}
+
+// Audited actions
+const (
+	AuditReservationUpdated   = "reservation.updated"
+	AuditReservationStatus    = "reservation.status"
+	AuditReservationDeleted   = "reservation.deleted"
+	AuditReservationCancelled = "reservation.cancelled"
+	AuditRoomCreated          = "room.created"
+	AuditRoomUpdated          = "room.updated"
+	AuditRoomDeleted          = "room.deleted"
+	AuditRoomBlocked          = "room.blocked"
+	AuditRoomUnblocked        = "room.unblocked"
+	AuditSeasonalRateCreated  = "seasonal_rate.created"
+	AuditSeasonalRateDeleted  = "seasonal_rate.deleted"
+	AuditStayRuleCreated      = "stay_rule.created"
+	AuditStayRuleDeleted      = "stay_rule.deleted"
+	AuditUserCreated          = "user.created"
+	AuditUserUpdated          = "user.updated"
+	AuditWebhookCreated       = "webhook.created"
+	AuditWebhookUpdated       = "webhook.updated"
+	AuditWebhookDeleted       = "webhook.deleted"
+	AuditICalFeedCreated      = "ical_feed.created"
+	AuditICalFeedDeleted      = "ical_feed.deleted"
+)
+
+// AuditActions are the audited actions, in the order the audit filter offers them
+var AuditActions = []string{
+	AuditReservationUpdated,
+	AuditReservationStatus,
+	AuditReservationDeleted,
+	AuditReservationCancelled,
+	AuditRoomCreated,
+	AuditRoomUpdated,
+	AuditRoomDeleted,
+	AuditRoomBlocked,
+	AuditRoomUnblocked,
+	AuditSeasonalRateCreated,
+	AuditSeasonalRateDeleted,
+	AuditStayRuleCreated,
+	AuditStayRuleDeleted,
+	AuditUserCreated,
+	AuditUserUpdated,
+	AuditWebhookCreated,
+	AuditWebhookUpdated,
+	AuditWebhookDeleted,
+	AuditICalFeedCreated,
+	AuditICalFeedDeleted,
+}
+
+// AuditEvent records a change made in the admin area. Before and After hold the changed fields as
+// JSON objects, Before is empty for something new and After for something deleted.
+type AuditEvent struct {
+	ID        int
+	UserID    int
+	User      User
+	Action    string
+	Entity    string
+	EntityID  int
+	Before    string
+	After     string
+	IPAddress string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AuditActor is who makes the changes recorded in the audit log, and from where
+type AuditActor struct {
+	UserID    int
+	IPAddress string
+}
+
+// AuditFilter narrows the audit events listed. Zero fields do not filter.
+type AuditFilter struct {
+	UserID   int
+	Action   string
+	Entity   string
+	EntityID int
+	From     time.Time
+	To       time.Time
+}
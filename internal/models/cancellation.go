@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// CancellationPolicy describes what guests owe when they cancel their own booking
+type CancellationPolicy struct {
+	// FreeDays is how many days before arrival a booking can still be cancelled for free
+	FreeDays int
+	// FeePercent is the share of the total price charged for later cancellations
+	FeePercent int
+}
+
+// Fee returns the cancellation fee in cents for cancelling res at now
+func (p CancellationPolicy) Fee(res Reservation, now time.Time) int {
+	deadline := res.StartDate.AddDate(0, 0, -p.FreeDays)
+	if now.Before(deadline) {
+		return 0
+	}
+	return res.TotalPrice * p.FeePercent / 100
+}
+
+// GuestCanChange reports whether a guest may still change or cancel res at now
+func GuestCanChange(res Reservation, now time.Time) bool {
+	if res.Status != StatusPending && res.Status != StatusConfirmed {
+		return false
+	}
+	return now.Before(res.StartDate)
+}
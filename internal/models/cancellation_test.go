@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancellationPolicyFee(t *testing.T) {
+	policy := CancellationPolicy{FreeDays: 2, FeePercent: 50}
+	res := Reservation{
+		StartDate:  time.Date(2050, 7, 10, 0, 0, 0, 0, time.UTC),
+		TotalPrice: 30000,
+	}
+
+	if fee := policy.Fee(res, time.Date(2050, 7, 7, 23, 0, 0, 0, time.UTC)); fee != 0 {
+		t.Errorf("expected free cancellation before the deadline, got %d", fee)
+	}
+
+	if fee := policy.Fee(res, time.Date(2050, 7, 8, 9, 0, 0, 0, time.UTC)); fee != 15000 {
+		t.Errorf("expected a fee of 15000 after the deadline, got %d", fee)
+	}
+}
+
+func TestGuestCanChange(t *testing.T) {
+	res := Reservation{
+		StartDate: time.Date(2050, 7, 10, 0, 0, 0, 0, time.UTC),
+		Status:    StatusConfirmed,
+	}
+	before := time.Date(2050, 7, 9, 0, 0, 0, 0, time.UTC)
+
+	if !GuestCanChange(res, before) {
+		t.Error("expected a confirmed future booking to be changeable")
+	}
+
+	if GuestCanChange(res, res.StartDate) {
+		t.Error("expected a booking to be locked on arrival day")
+	}
+
+	res.Status = StatusCancelled
+	if GuestCanChange(res, before) {
+		t.Error("expected a cancelled booking to be locked")
+	}
+}
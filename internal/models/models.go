@@ -12,18 +12,92 @@ type User struct {
 	Email       string
 	Password    string
 	AccessLevel int
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// Active is false for deactivated users, who can no longer log in
+	Active bool
+	// SessionVersion is stored in sessions at login and bumped to log the user out everywhere
+	SessionVersion int
+	// TOTPSecret is the two-factor authentication secret, empty until the user sets it up
+	TOTPSecret string
+	// TOTPLastStep is the time step of the last code used, so no code can be used twice
+	TOTPLastStep int64
+	// TOTPRequired is set by owners to make the user set up two-factor authentication
+	TOTPRequired bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
-// Room is the room model
-type Room struct {
+// UserToken is a one-time link sent to a user by email, such as an invitation to set a password.
+// Only the hash of the token is stored.
+type UserToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	User      User
+}
+
+// APIToken lets a user's scripts and integrations call the API. Only the hash of the token is stored.
+type APIToken struct {
+	ID     int
+	UserID int
+	Name   string
+	// Display is the start of the token, to tell tokens apart
+	Display    string
+	TokenHash  string
+	Scope      string
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	User       User
+}
+
+// TrustedDevice is a browser where a user has passed the two-factor step and asked not to be asked
+// again for a while. The browser keeps the token in a cookie, only its hash is stored.
+type TrustedDevice struct {
 	ID        int
-	RoomName  string
+	UserID    int
+	TokenHash string
+	UserAgent string
+	ExpiresAt time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// UserSession is a browser where a user is logged in. The token is the token of the session, which
+// is deleted from the session store to sign the browser out.
+type UserSession struct {
+	ID         int
+	UserID     int
+	Token      string
+	IPAddress  string
+	UserAgent  string
+	LastSeenAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Room is the room model
+type Room struct {
+	ID          int
+	RoomName    string
+	Slug        string
+	Description string
+	Images      []string
+	Capacity    int
+	Amenities   []string
+	// NightlyRate is the base price of one night in cents
+	NightlyRate int
+	// WeekendUplift is the percentage added to Friday and Saturday nights
+	WeekendUplift int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
 // Restriction is the restriction model
 type Restriction struct {
 	ID              int
@@ -45,7 +119,20 @@ type Reservation struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
-	Processed int
+	// Status is one of the Status constants, the other timestamps record when it was entered
+	Status       string
+	ConfirmedAt  time.Time
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	CancelledAt  time.Time
+	NoShowAt     time.Time
+	// TotalPrice is the price of the stay in cents
+	TotalPrice int
+	PriceLines []QuoteLine
+	// CancellationFee is what the guest owes, in cents, after cancelling
+	CancellationFee int
+	// Sequence is the revision of the reservation's calendar event, raised on every change
+	Sequence int
 }
 
 // RoomRestriction is the room restriction model
@@ -61,13 +148,189 @@ type RoomRestriction struct {
 	Room          Room
 	Reservation   Reservation
 	Restriction   Restriction
+	// ICalFeedID and ExternalUID identify restrictions imported from an external calendar
+	ICalFeedID  int
+	ExternalUID string
+}
+
+// ICalFeed is an external calendar whose events are imported as room restrictions
+type ICalFeed struct {
+	ID           int
+	RoomID       int
+	Name         string
+	URL          string
+	LastSyncedAt time.Time
+	// LastStatus is empty before the first sync, then "ok", "warning" or "error"
+	LastStatus string
+	LastError  string
+	EventCount int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Room       Room
+}
+
+// SeasonalRate overrides the nightly rate of a room between two dates, both inclusive
+type SeasonalRate struct {
+	ID          int
+	RoomID      int
+	Name        string
+	StartDate   time.Time
+	EndDate     time.Time
+	NightlyRate int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// StayRule limits the stays in a room between two dates, both inclusive.
+// Zero MinNights or MaxNights means no limit.
+type StayRule struct {
+	ID                int
+	RoomID            int
+	StartDate         time.Time
+	EndDate           time.Time
+	MinNights         int
+	MaxNights         int
+	ClosedToArrival   []time.Weekday
+	ClosedToDeparture []time.Weekday
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Room              Room
+}
+
+// QuoteLine is the price of a single night of a stay
+type QuoteLine struct {
+	Date        time.Time `json:"date"`
+	Description string    `json:"description"`
+	Amount      int       `json:"amount"`
+}
+
+// Quote is the price of a stay with its nightly breakdown
+type Quote struct {
+	RoomID    int
+	StartDate time.Time
+	EndDate   time.Time
+	Lines     []QuoteLine
+	Total     int
 }
 
 // MailData holds an email message
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To      string
+	From    string
+	Subject string
+	// Content is the html body, PlainText its text/plain alternative
+	Content     string
+	PlainText   string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// Property describes the hotel in emails and calendar invitations
+type Property struct {
+	Name    string
+	Address string
+	// CheckIn and CheckOut are the times of day guests arrive and leave
+	CheckIn  time.Duration
+	CheckOut time.Duration
+	Location *time.Location
+}
+
+// EmailData holds data sent to email templates
+type EmailData struct {
+	Subject   string
+	StringMap map[string]string
+	IntMap    map[string]int
+	Data      map[string]interface{}
+	// PropertyName is the name of the hotel, filled in when the email is rendered
+	PropertyName string
+}
+
+// Outbox email statuses
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// OutboxEmail is an email queued for delivery in the email_outbox table
+type OutboxEmail struct {
+	ID            int
+	Mail          MailData
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Reservation events sent to webhooks
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationUpdated   = "reservation.updated"
+	EventReservationProcessed = "reservation.processed"
+	EventReservationCancelled = "reservation.cancelled"
+	EventReservationDeleted   = "reservation.deleted"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	EventReservationCreated,
+	EventReservationUpdated,
+	EventReservationProcessed,
+	EventReservationCancelled,
+	EventReservationDeleted,
+}
+
+// Webhook is a URL that is sent the reservation events it subscribes to
+type Webhook struct {
+	ID  int
+	URL string
+	// Secret signs the payloads so the receiver can check they came from us
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Subscribes reports whether the webhook wants to receive event
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookMessage is an event with its encoded payload, queued for every webhook subscribing to the event
+type WebhookMessage struct {
+	Event   string
+	Payload []byte
+}
+
+// WebhookDelivery is an event queued for, or sent to, one webhook. Its status is one of the outbox statuses.
+type WebhookDelivery struct {
+	ID            int
+	WebhookID     int
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	// ResponseStatus is the HTTP status of the last attempt, 0 if there was no response
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Webhook        Webhook
 }
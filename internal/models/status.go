@@ -0,0 +1,59 @@
+package models
+
+// Reservation statuses
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusCheckedIn  = "checked-in"
+	StatusCheckedOut = "checked-out"
+	StatusCancelled  = "cancelled"
+	StatusNoShow     = "no-show"
+)
+
+// ReservationStatuses lists every reservation status in lifecycle order
+var ReservationStatuses = []string{
+	StatusPending,
+	StatusConfirmed,
+	StatusCheckedIn,
+	StatusCheckedOut,
+	StatusCancelled,
+	StatusNoShow,
+}
+
+// statusTransitions maps each status to the statuses a reservation may move to from it.
+// Checked-out, cancelled and no-show reservations are final.
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCheckedOut},
+}
+
+// IsReservationStatus reports whether s is a known reservation status
+func IsReservationStatus(s string) bool {
+	for _, status := range ReservationStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStatuses returns the statuses a reservation in status from may move to
+func NextStatuses(from string) []string {
+	return statusTransitions[from]
+}
+
+// CanTransition reports whether a reservation may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether a reservation in this status still holds its room
+func IsActive(status string) bool {
+	return status != StatusCancelled && status != StatusNoShow
+}
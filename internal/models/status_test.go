@@ -0,0 +1,43 @@
+package models
+
+import "testing"
+
+var transitionTests = []struct {
+	from    string
+	to      string
+	allowed bool
+}{
+	{StatusPending, StatusConfirmed, true},
+	{StatusPending, StatusCancelled, true},
+	{StatusPending, StatusCheckedIn, false},
+	{StatusConfirmed, StatusCheckedIn, true},
+	{StatusConfirmed, StatusNoShow, true},
+	{StatusConfirmed, StatusPending, false},
+	{StatusCheckedIn, StatusCheckedOut, true},
+	{StatusCheckedIn, StatusCancelled, false},
+	{StatusCheckedOut, StatusCheckedIn, false},
+	{StatusCancelled, StatusConfirmed, false},
+	{StatusNoShow, StatusConfirmed, false},
+	{"unknown", StatusConfirmed, false},
+}
+
+func TestCanTransition(t *testing.T) {
+	for _, e := range transitionTests {
+		if got := CanTransition(e.from, e.to); got != e.allowed {
+			t.Errorf("%s -> %s: expected %v but got %v", e.from, e.to, e.allowed, got)
+		}
+	}
+}
+
+func TestTransitionsUseKnownStatuses(t *testing.T) {
+	for from, next := range statusTransitions {
+		if !IsReservationStatus(from) {
+			t.Errorf("unknown status %q in transitions", from)
+		}
+		for _, to := range next {
+			if !IsReservationStatus(to) {
+				t.Errorf("unknown status %q in transitions from %s", to, from)
+			}
+		}
+	}
+}
@@ -14,4 +14,6 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated bool
+	// AccessLevel is the role of the logged in staff user, used with the can function to hide actions
+	AccessLevel int
 }
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Reasons a login attempt failed
+const (
+	LoginFailurePassword  = "password"
+	LoginFailureTwoFactor = "two_factor"
+	// LoginFailureThrottled is an attempt refused while waiting or locked out. It is recorded but
+	// does not count towards further delays.
+	LoginFailureThrottled = "throttled"
+)
+
+// LoginFailure records a failed login attempt for the audit log and for throttling
+type LoginFailure struct {
+	ID        int
+	Email     string
+	IPAddress string
+	UserAgent string
+	Reason    string
+	// Cleared failures no longer count, after a successful login or an admin unlocked the account
+	Cleared   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LoginCounts sums up the counted failures of an account or an IP address within the throttle window
+type LoginCounts struct {
+	Failures int
+	Last     time.Time
+}
+
+// LockedAccount is an account locked out by failed logins, shown to admins to unlock
+type LockedAccount struct {
+	Email    string
+	Failures int
+	Last     time.Time
+}
+
+// LoginThrottle slows down and then locks out repeated failed logins, per account and per IP address
+type LoginThrottle struct {
+	// Window is how long failures count, and so how long a lockout lasts after the last one
+	Window time.Duration
+	// FreeFailures is how many failures an account may have before each attempt must wait
+	FreeFailures int
+	// BaseDelay is the first wait, doubling with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// AccountLockout is how many failures lock an account
+	AccountLockout int
+	// IPFreeFailures and IPLockout are the same limits for one IP address across all accounts,
+	// higher since many users can share an address. An IPLockout of 0 turns them off, as every
+	// visitor has the address of the proxy in front of the site unless it is trusted.
+	IPFreeFailures int
+	IPLockout      int
+}
+
+// Check returns how long to wait before the next attempt for an account and IP address with the
+// given failures is allowed, and whether that is because of a lockout
+func (t LoginThrottle) Check(account, ip LoginCounts, now time.Time) (time.Duration, bool) {
+	if t.IPLockout == 0 {
+		ip = LoginCounts{}
+	}
+
+	if account.Failures >= t.AccountLockout {
+		if wait := account.Last.Add(t.Window).Sub(now); wait > 0 {
+			return wait, true
+		}
+	}
+	if t.IPLockout > 0 && ip.Failures >= t.IPLockout {
+		if wait := ip.Last.Add(t.Window).Sub(now); wait > 0 {
+			return wait, true
+		}
+	}
+
+	wait := account.Last.Add(t.delay(account.Failures, t.FreeFailures)).Sub(now)
+	if ipWait := ip.Last.Add(t.delay(ip.Failures, t.IPFreeFailures)).Sub(now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, false
+}
+
+// delay returns the wait after failures, none until free failures have been used up
+func (t LoginThrottle) delay(failures, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	doublings := failures - free
+	if doublings > 30 {
+		return t.MaxDelay
+	}
+	if d := t.BaseDelay << doublings; d < t.MaxDelay {
+		return d
+	}
+	return t.MaxDelay
+}
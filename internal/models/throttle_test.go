@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleCheck(t *testing.T) {
+	throttle := LoginThrottle{
+		Window:         15 * time.Minute,
+		FreeFailures:   3,
+		BaseDelay:      time.Second,
+		MaxDelay:       30 * time.Second,
+		AccountLockout: 10,
+		IPFreeFailures: 10,
+		IPLockout:      50,
+	}
+	now := time.Date(2050, 7, 10, 12, 0, 0, 0, time.UTC)
+	last := now.Add(-time.Second)
+
+	tests := []struct {
+		name    string
+		account LoginCounts
+		ip      LoginCounts
+		wait    time.Duration
+		locked  bool
+	}{
+		{"no failures", LoginCounts{}, LoginCounts{}, 0, false},
+		{"free failures", LoginCounts{2, last}, LoginCounts{2, last}, 0, false},
+		{"first delay", LoginCounts{3, last}, LoginCounts{3, last}, 0, false},
+		{"doubling delay", LoginCounts{5, last}, LoginCounts{5, last}, 3 * time.Second, false},
+		{"capped delay", LoginCounts{9, last}, LoginCounts{9, last}, 29 * time.Second, false},
+		{"delay has passed", LoginCounts{9, now.Add(-time.Minute)}, LoginCounts{9, now.Add(-time.Minute)}, 0, false},
+		{"account locked", LoginCounts{10, last}, LoginCounts{10, last}, 15*time.Minute - time.Second, true},
+		{"account lockout over", LoginCounts{10, now.Add(-15 * time.Minute)}, LoginCounts{}, 0, false},
+		{"ip delay", LoginCounts{1, last}, LoginCounts{12, last}, 3 * time.Second, false},
+		{"ip locked", LoginCounts{}, LoginCounts{50, last}, 15*time.Minute - time.Second, true},
+	}
+
+	for _, tt := range tests {
+		wait, locked := throttle.Check(tt.account, tt.ip, now)
+		if wait != tt.wait || locked != tt.locked {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, wait, locked, tt.wait, tt.locked)
+		}
+	}
+
+	// without an IP lockout, failures from one address do not slow down or lock anyone out
+	throttle.IPLockout = 0
+	wait, locked := throttle.Check(LoginCounts{1, last}, LoginCounts{500, last}, now)
+	if wait != 0 || locked {
+		t.Errorf("ip limits off: got %v %v, want 0 false", wait, locked)
+	}
+}
@@ -0,0 +1,79 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	ID      int            `json:"id"`
+	Name    string         `json:"name,omitempty"`
+	Day     string         `json:"day" format:"date"`
+	Tags    []string       `json:"tags"`
+	Counts  map[string]int `json:"counts"`
+	At      time.Time      `json:"at"`
+	Parent  *testItem      `json:"parent,omitempty"`
+	Ignored string         `json:"-"`
+	hidden  string
+}
+
+func TestSchema(t *testing.T) {
+	d := New(Info{Title: "Test", Version: "1"})
+
+	s := d.Schema([]testItem{})
+	if s.Type != "array" || s.Items.Ref != "#/components/schemas/testItem" {
+		t.Fatalf("unexpected schema %+v", s)
+	}
+
+	item := d.Components.Schemas["testItem"]
+	if item == nil {
+		t.Fatal("testItem was not added to the components")
+	}
+
+	expected := map[string]Schema{
+		"id":   {Type: "integer"},
+		"name": {Type: "string"},
+		"day":  {Type: "string", Format: "date"},
+		"at":   {Type: "string", Format: "date-time"},
+	}
+	for name, want := range expected {
+		got := item.Properties[name]
+		if got == nil || got.Type != want.Type || got.Format != want.Format {
+			t.Errorf("%s: expected %+v but got %+v", name, want, got)
+		}
+	}
+
+	if item.Properties["tags"].Items.Type != "string" {
+		t.Error("tags should be an array of strings")
+	}
+	if item.Properties["counts"].AdditionalProperties.Type != "integer" {
+		t.Error("counts should be an object of integers")
+	}
+	if item.Properties["parent"].Ref != "#/components/schemas/testItem" {
+		t.Error("parent should refer to testItem")
+	}
+	if _, ok := item.Properties["Ignored"]; ok {
+		t.Error("fields tagged json:\"-\" should be left out")
+	}
+	if _, ok := item.Properties["hidden"]; ok {
+		t.Error("unexported fields should be left out")
+	}
+
+	required := []string{"id", "day", "tags", "counts", "at"}
+	if !reflect.DeepEqual(item.Required, required) {
+		t.Errorf("expected required %v but got %v", required, item.Required)
+	}
+}
+
+func TestAddOperation(t *testing.T) {
+	d := New(Info{Title: "Test", Version: "1"})
+	d.Add("GET", "/items/{id}", Operation{OperationID: "getItem"})
+
+	if !d.HasOperation("get", "/items/{id}") {
+		t.Error("expected GET /items/{id}")
+	}
+	if d.HasOperation("POST", "/items/{id}") {
+		t.Error("did not expect POST /items/{id}")
+	}
+}
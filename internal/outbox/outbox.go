@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"bookings/internal/mailer"
+	"bookings/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultMaxAttempts is how often an email is tried before it is marked as failed
+const DefaultMaxAttempts = 8
+
+const (
+	// batchSize is the number of emails claimed per poll
+	batchSize = 20
+	// lease keeps a claimed email away from other workers while it is being sent
+	lease = 5 * time.Minute
+	// firstRetry is the delay after the first failed attempt, doubled after every further failure
+	firstRetry = 30 * time.Second
+	// maxRetry caps the delay between two attempts
+	maxRetry = 6 * time.Hour
+)
+
+// Store is the part of the database repository used by the worker
+type Store interface {
+	ClaimDueEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error)
+	MarkEmailSent(id int) error
+	MarkEmailFailed(id int, lastError string, nextAttempt time.Time, dead bool) error
+}
+
+// Worker delivers the emails queued in the outbox, retrying failures with exponential backoff
+type Worker struct {
+	DB          Store
+	Mailer      mailer.Mailer
+	MaxAttempts int
+	ErrorLog    *log.Logger
+}
+
+// NewWorker creates a new outbox worker
+func NewWorker(db Store, m mailer.Mailer, maxAttempts int, errorLog *log.Logger) *Worker {
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &Worker{
+		DB:          db,
+		Mailer:      m,
+		MaxAttempts: maxAttempts,
+		ErrorLog:    errorLog,
+	}
+}
+
+// Start polls the outbox every interval until done is closed
+func (w *Worker) Start(interval time.Duration, done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			err := w.Deliver(time.Now())
+			if err != nil {
+				w.ErrorLog.Println(err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Deliver sends the emails that are due and records the outcome of each attempt
+func (w *Worker) Deliver(now time.Time) error {
+	emails, err := w.DB.ClaimDueEmails(batchSize, lease)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range emails {
+		err := w.Mailer.Send(e.Mail)
+		if err == nil {
+			err = w.DB.MarkEmailSent(e.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		attempts := e.Attempts + 1
+		dead := attempts >= w.MaxAttempts
+		if dead {
+			w.ErrorLog.Printf("giving up on email %d to %s after %d attempts: %v", e.ID, e.Mail.To, attempts, err)
+		}
+
+		err = w.DB.MarkEmailFailed(e.ID, err.Error(), now.Add(Backoff(attempts)), dead)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetry {
+			return maxRetry
+		}
+	}
+	return delay
+}
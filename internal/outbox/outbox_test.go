@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"bookings/internal/models"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+type failure struct {
+	id      int
+	next    time.Time
+	dead    bool
+	message string
+}
+
+type fakeStore struct {
+	due    []models.OutboxEmail
+	sent   []int
+	failed []failure
+}
+
+func (s *fakeStore) QueueEmail(msg models.MailData) error {
+	s.due = append(s.due, models.OutboxEmail{ID: len(s.due) + 1, Mail: msg})
+	return nil
+}
+
+func (s *fakeStore) ClaimDueEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *fakeStore) MarkEmailSent(id int) error {
+	s.sent = append(s.sent, id)
+	return nil
+}
+
+func (s *fakeStore) MarkEmailFailed(id int, lastError string, nextAttempt time.Time, dead bool) error {
+	s.failed = append(s.failed, failure{id: id, next: nextAttempt, dead: dead, message: lastError})
+	return nil
+}
+
+// downMailer fails to deliver to down@here.com
+type downMailer struct{}
+
+func (downMailer) Send(msg models.MailData) error {
+	if msg.To == "down@here.com" {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, maxRetry},
+		{50, maxRetry},
+	}
+
+	for _, e := range tests {
+		if got := Backoff(e.attempts); got != e.expected {
+			t.Errorf("%d attempts: expected %s but got %s", e.attempts, e.expected, got)
+		}
+	}
+}
+
+func TestWorker_Deliver(t *testing.T) {
+	store := &fakeStore{
+		due: []models.OutboxEmail{
+			{ID: 1, Mail: models.MailData{To: "ok@here.com"}},
+			{ID: 2, Mail: models.MailData{To: "down@here.com"}, Attempts: 0},
+			{ID: 3, Mail: models.MailData{To: "down@here.com"}, Attempts: 2},
+		},
+	}
+
+	w := NewWorker(store, downMailer{}, 3, log.New(io.Discard, "", 0))
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	err := w.Deliver(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.sent) != 1 || store.sent[0] != 1 {
+		t.Errorf("expected email 1 to be sent, got %v", store.sent)
+	}
+
+	if len(store.failed) != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(store.failed))
+	}
+
+	retry := store.failed[0]
+	if retry.dead {
+		t.Error("email 2 should be retried after its first attempt")
+	}
+	if !retry.next.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("expected email 2 to be retried at %s but got %s", now.Add(30*time.Second), retry.next)
+	}
+	if retry.message != "connection refused" {
+		t.Errorf("expected the send error to be recorded, got %q", retry.message)
+	}
+
+	if !store.failed[1].dead {
+		t.Error("email 3 should be dead-lettered after its third attempt")
+	}
+}
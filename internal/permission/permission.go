@@ -0,0 +1,94 @@
+package permission
+
+// Roles of staff users, stored in User.AccessLevel. Zero is no role and cannot enter the admin area.
+const (
+	RoleReadOnly  = 1
+	RoleFrontDesk = 2
+	RoleManager   = 3
+	RoleOwner     = 4
+)
+
+// Permissions checked by the admin routes, the API and the templates
+const (
+	// View lets a user into the admin area to look at reservations, rooms and settings
+	View = "view"
+	// EditReservations allows changing reservations, their status and calendar blocks, and sending reminders
+	EditReservations = "reservations.edit"
+	// DeleteReservations allows deleting reservations
+	DeleteReservations = "reservations.delete"
+	// ManageEmails allows resending failed emails
+	ManageEmails = "emails.manage"
+	// ManageRooms allows changing rooms, rates, stay rules and calendar feeds
+	ManageRooms = "rooms.manage"
+	// ManageWebhooks allows seeing and changing webhooks, whose secrets are shown to those who may
+	ManageWebhooks = "webhooks.manage"
+	// ManageUsers allows managing staff users and their roles
+	ManageUsers = "users.manage"
+	// ViewAudit allows reading the audit log of changes made in the admin area
+	ViewAudit = "audit.view"
+)
+
+// Role is a named set of permissions
+type Role struct {
+	Level       int
+	Name        string
+	Permissions []string
+}
+
+// Roles is the permission matrix, from the least to the most powerful role
+var Roles = []Role{
+	{
+		Level:       RoleReadOnly,
+		Name:        "Read-only",
+		Permissions: []string{View},
+	},
+	{
+		Level:       RoleFrontDesk,
+		Name:        "Front desk",
+		Permissions: []string{View, EditReservations, ManageEmails},
+	},
+	{
+		Level:       RoleManager,
+		Name:        "Manager",
+		Permissions: []string{View, EditReservations, ManageEmails, DeleteReservations, ManageRooms, ViewAudit},
+	},
+	{
+		Level:       RoleOwner,
+		Name:        "Owner",
+		Permissions: []string{View, EditReservations, ManageEmails, DeleteReservations, ManageRooms, ViewAudit, ManageWebhooks, ManageUsers},
+	},
+}
+
+// Lookup returns the role of an access level
+func Lookup(level int) (Role, bool) {
+	for _, r := range Roles {
+		if r.Level == level {
+			return r, true
+		}
+	}
+	return Role{}, false
+}
+
+// RoleName returns the name of the role of an access level
+func RoleName(level int) string {
+	r, ok := Lookup(level)
+	if !ok {
+		return "None"
+	}
+	return r.Name
+}
+
+// Can reports whether a user with the access level has permission
+func Can(level int, permission string) bool {
+	r, ok := Lookup(level)
+	if !ok {
+		return false
+	}
+
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
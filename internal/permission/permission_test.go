@@ -0,0 +1,55 @@
+package permission
+
+import "testing"
+
+var canTests = []struct {
+	level      int
+	permission string
+	allowed    bool
+}{
+	{0, View, false},
+	{RoleReadOnly, View, true},
+	{RoleReadOnly, EditReservations, false},
+	{RoleFrontDesk, EditReservations, true},
+	{RoleFrontDesk, ManageEmails, true},
+	{RoleFrontDesk, DeleteReservations, false},
+	{RoleFrontDesk, ManageRooms, false},
+	{RoleFrontDesk, ViewAudit, false},
+	{RoleManager, DeleteReservations, true},
+	{RoleManager, ManageRooms, true},
+	{RoleManager, ViewAudit, true},
+	{RoleManager, ManageWebhooks, false},
+	{RoleManager, ManageUsers, false},
+	{RoleOwner, ManageWebhooks, true},
+	{RoleOwner, ManageUsers, true},
+	{RoleOwner, "unknown", false},
+	{99, View, false},
+}
+
+func TestCan(t *testing.T) {
+	for _, e := range canTests {
+		if got := Can(e.level, e.permission); got != e.allowed {
+			t.Errorf("level %d, %s: expected %v but got %v", e.level, e.permission, e.allowed, got)
+		}
+	}
+}
+
+func TestRolesGrowInPower(t *testing.T) {
+	// every role can do everything the roles below it can
+	for i := 1; i < len(Roles); i++ {
+		for _, p := range Roles[i-1].Permissions {
+			if !Can(Roles[i].Level, p) {
+				t.Errorf("%s cannot %s, but %s can", Roles[i].Name, p, Roles[i-1].Name)
+			}
+		}
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	if got := RoleName(RoleOwner); got != "Owner" {
+		t.Errorf("expected Owner but got %s", got)
+	}
+	if got := RoleName(0); got != "None" {
+		t.Errorf("expected None but got %s", got)
+	}
+}
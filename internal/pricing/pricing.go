@@ -0,0 +1,124 @@
+package pricing
+
+import (
+	"bookings/internal/models"
+	"bookings/internal/repository"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidStay is returned when the departure date is not after the arrival date
+var ErrInvalidStay = errors.New("departure must be after arrival")
+
+// Engine quotes stays using the rates stored in the database
+type Engine struct {
+	DB repository.DatabaseRepo
+}
+
+// NewEngine creates a new pricing engine
+func NewEngine(db repository.DatabaseRepo) *Engine {
+	return &Engine{
+		DB: db,
+	}
+}
+
+// QuoteStay prices a stay in a room from the arrival (start) to the departure (end) date
+func (e *Engine) QuoteStay(roomID int, start, end time.Time) (models.Quote, error) {
+	room, err := e.DB.GetRoomByID(roomID)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	seasons, err := e.DB.GetSeasonalRatesForRoomByDate(roomID, start, end)
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	return BuildQuote(room, seasons, start, end)
+}
+
+// BuildQuote prices every night between start and end. A night uses the rate of the first
+// season covering it, or the room's base rate, and Friday and Saturday nights get the
+// room's weekend uplift on top.
+func BuildQuote(room models.Room, seasons []models.SeasonalRate, start, end time.Time) (models.Quote, error) {
+	quote := models.Quote{
+		RoomID:    room.ID,
+		StartDate: start,
+		EndDate:   end,
+	}
+
+	if !end.After(start) {
+		return quote, ErrInvalidStay
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		line := models.QuoteLine{
+			Date:        d,
+			Description: "Base rate",
+			Amount:      room.NightlyRate,
+		}
+
+		for _, season := range seasons {
+			if !d.Before(season.StartDate) && !d.After(season.EndDate) {
+				line.Description = season.Name
+				line.Amount = season.NightlyRate
+				break
+			}
+		}
+
+		if isWeekendNight(d) && room.WeekendUplift > 0 {
+			line.Description = fmt.Sprintf("%s, weekend +%d%%", line.Description, room.WeekendUplift)
+			line.Amount += line.Amount * room.WeekendUplift / 100
+		}
+
+		quote.Lines = append(quote.Lines, line)
+		quote.Total += line.Amount
+	}
+
+	return quote, nil
+}
+
+// isWeekendNight reports whether the night starting on d is a Friday or Saturday night
+func isWeekendNight(d time.Time) bool {
+	return d.Weekday() == time.Friday || d.Weekday() == time.Saturday
+}
+
+// FormatAmount formats an amount of cents as a decimal string, such as 120.50
+func FormatAmount(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// ParseAmount parses a decimal string, such as 120.5, into cents
+func ParseAmount(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > 2 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	units, err := strconv.Atoi(whole)
+	if err != nil || units < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	cents := 0
+	if frac != "" {
+		cents, err = strconv.Atoi(frac)
+		if err != nil || cents < 0 {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		if len(frac) == 1 {
+			cents *= 10
+		}
+	}
+
+	return units*100 + cents, nil
+}
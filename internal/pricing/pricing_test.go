@@ -0,0 +1,130 @@
+package pricing
+
+import (
+	"bookings/internal/models"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func TestBuildQuote(t *testing.T) {
+	room := models.Room{ID: 1, NightlyRate: 10000, WeekendUplift: 20}
+	seasons := []models.SeasonalRate{
+		{Name: "Summer", StartDate: date("2050-07-04"), EndDate: date("2050-07-05"), NightlyRate: 15000},
+	}
+
+	// 2050-07-01 is a Friday: Fri, Sat (weekend), Sun, Mon (summer), Tue (summer)
+	quote, err := BuildQuote(room, seasons, date("2050-07-01"), date("2050-07-06"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{12000, 12000, 10000, 15000, 15000}
+	if len(quote.Lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(quote.Lines))
+	}
+
+	for i, amount := range expected {
+		if quote.Lines[i].Amount != amount {
+			t.Errorf("night %d: expected %d but got %d (%s)", i, amount, quote.Lines[i].Amount, quote.Lines[i].Description)
+		}
+	}
+
+	if quote.Total != 64000 {
+		t.Errorf("expected total of 64000 but got %d", quote.Total)
+	}
+
+	if quote.Lines[3].Description != "Summer" {
+		t.Errorf("expected season name on line, got %q", quote.Lines[3].Description)
+	}
+}
+
+// 2050-07-01 is a Friday
+var seasonalSeasons = []models.SeasonalRate{
+	{Name: "Summer", StartDate: date("2050-07-05"), EndDate: date("2050-07-07"), NightlyRate: 15000},
+	{Name: "Peak", StartDate: date("2050-07-08"), EndDate: date("2050-07-09"), NightlyRate: 20000},
+}
+
+var seasonalQuoteTests = []struct {
+	name   string
+	uplift int
+	start  string
+	end    string
+	nights []int
+	total  int
+}{
+	{"before the seasons", 0, "2050-07-02", "2050-07-05", []int{10000, 10000, 10000}, 30000},
+	{"into a season", 0, "2050-07-04", "2050-07-06", []int{10000, 15000}, 25000},
+	{"whole season", 0, "2050-07-05", "2050-07-08", []int{15000, 15000, 15000}, 45000},
+	{"from one season into the next", 0, "2050-07-07", "2050-07-09", []int{15000, 20000}, 35000},
+	{"out of a season", 0, "2050-07-09", "2050-07-11", []int{20000, 10000}, 30000},
+	{"after the seasons", 0, "2050-07-10", "2050-07-12", []int{10000, 10000}, 20000},
+	{"across both seasons", 0, "2050-07-04", "2050-07-11", []int{10000, 15000, 15000, 15000, 20000, 20000, 10000}, 105000},
+	{"weekend uplift on a season", 20, "2050-07-07", "2050-07-10", []int{15000, 24000, 24000}, 63000},
+}
+
+func TestBuildQuoteSeasonalBoundaries(t *testing.T) {
+	for _, e := range seasonalQuoteTests {
+		room := models.Room{ID: 1, NightlyRate: 10000, WeekendUplift: e.uplift}
+
+		quote, err := BuildQuote(room, seasonalSeasons, date(e.start), date(e.end))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+
+		if len(quote.Lines) != len(e.nights) {
+			t.Errorf("%s: expected %d nights, got %d", e.name, len(e.nights), len(quote.Lines))
+			continue
+		}
+		for i, amount := range e.nights {
+			if quote.Lines[i].Amount != amount {
+				t.Errorf("%s: night of %s expected %d but got %d (%s)", e.name,
+					quote.Lines[i].Date.Format("2006-01-02"), amount, quote.Lines[i].Amount, quote.Lines[i].Description)
+			}
+		}
+
+		if quote.Total != e.total {
+			t.Errorf("%s: expected total of %d but got %d", e.name, e.total, quote.Total)
+		}
+	}
+}
+
+func TestBuildQuoteInvalidStay(t *testing.T) {
+	_, err := BuildQuote(models.Room{}, nil, date("2050-07-02"), date("2050-07-02"))
+	if err != ErrInvalidStay {
+		t.Errorf("expected ErrInvalidStay, got %v", err)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := map[int]string{0: "0.00", 5: "0.05", 12050: "120.50", -150: "-1.50"}
+	for cents, expected := range tests {
+		if got := FormatAmount(cents); got != expected {
+			t.Errorf("FormatAmount(%d): expected %s but got %s", cents, expected, got)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]int{"120": 12000, "120.5": 12050, "120.05": 12005, "0.99": 99}
+	for s, expected := range tests {
+		got, err := ParseAmount(s)
+		if err != nil {
+			t.Errorf("ParseAmount(%q): unexpected error %v", s, err)
+		}
+		if got != expected {
+			t.Errorf("ParseAmount(%q): expected %d but got %d", s, expected, got)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "1.234", "-5", ".5", "1.-5"} {
+		if _, err := ParseAmount(s); err == nil {
+			t.Errorf("ParseAmount(%q): expected an error", s)
+		}
+	}
+}
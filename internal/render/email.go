@@ -0,0 +1,97 @@
+package render
+
+import (
+	"bookings/internal/models"
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+var pathToEmailTemplates = "./email-templates"
+
+// Email renders the html and plain text variants of the named email template
+func Email(name string, ed *models.EmailData) (string, string, error) {
+	var htmlCache map[string]*template.Template
+	var textCache map[string]*texttemplate.Template
+
+	if app.UseCache {
+		htmlCache, textCache = app.EmailTemplateCache, app.EmailTextCache
+	} else {
+		var err error
+		htmlCache, textCache, err = CreateEmailTemplateCache()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	ht, ok := htmlCache[name+".page.html"]
+	if !ok {
+		return "", "", fmt.Errorf("could not get email template %s from cache", name)
+	}
+	tt, ok := textCache[name+".page.txt"]
+	if !ok {
+		return "", "", fmt.Errorf("could not get text email template %s from cache", name)
+	}
+
+	ed.PropertyName = app.Property.Name
+
+	htmlBuf := new(bytes.Buffer)
+	err := ht.Execute(htmlBuf, ed)
+	if err != nil {
+		return "", "", err
+	}
+
+	textBuf := new(bytes.Buffer)
+	err = tt.Execute(textBuf, ed)
+	if err != nil {
+		return "", "", err
+	}
+
+	return htmlBuf.String(), strings.TrimSpace(textBuf.String()) + "\n", nil
+}
+
+// CreateEmailTemplateCache creates the html and plain text email template caches. Every
+// *.page.html template must come with a *.page.txt variant.
+func CreateEmailTemplateCache() (map[string]*template.Template, map[string]*texttemplate.Template, error) {
+	htmlCache := map[string]*template.Template{}
+	textCache := map[string]*texttemplate.Template{}
+
+	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.html", pathToEmailTemplates))
+	if err != nil {
+		return htmlCache, textCache, err
+	}
+
+	for _, page := range pages {
+		name := filepath.Base(page)
+		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+
+		ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.html", pathToEmailTemplates))
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+
+		htmlCache[name] = ts
+
+		textPage := strings.TrimSuffix(page, ".html") + ".txt"
+		textName := filepath.Base(textPage)
+		tt, err := texttemplate.New(textName).Funcs(texttemplate.FuncMap(functions)).ParseFiles(textPage)
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+
+		tt, err = tt.ParseGlob(fmt.Sprintf("%s/*.layout.txt", pathToEmailTemplates))
+		if err != nil {
+			return htmlCache, textCache, err
+		}
+
+		textCache[textName] = tt
+	}
+
+	return htmlCache, textCache, nil
+}
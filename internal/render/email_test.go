@@ -0,0 +1,71 @@
+package render
+
+import (
+	"bookings/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateEmailTemplateCache(t *testing.T) {
+	pathToEmailTemplates = "./../../email-templates"
+
+	htmlCache, textCache, err := CreateEmailTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"confirmation", "update", "cancellation", "reminder", "admin-notice", "invitation", "password-reset"} {
+		if _, ok := htmlCache[name+".page.html"]; !ok {
+			t.Errorf("html template %s not found in cache", name)
+		}
+		if _, ok := textCache[name+".page.txt"]; !ok {
+			t.Errorf("text template %s not found in cache", name)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	pathToEmailTemplates = "./../../email-templates"
+	app.UseCache = false
+	app.Property.Name = "Harbour View Inn"
+
+	res := models.Reservation{
+		FirstName:  `<script>alert("hi")</script>`,
+		StartDate:  time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		TotalPrice: 20000,
+		Room:       models.Room{RoomName: "General's Quarters"},
+	}
+
+	html, text, err := Email("confirmation", &models.EmailData{
+		Subject:   "Reservation Confirmation",
+		StringMap: map[string]string{"link": "http://localhost:8080/my-booking/abc"},
+		Data:      map[string]interface{}{"reservation": res},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(html, "<script>") {
+		t.Error("guest name was not escaped in the html email")
+	}
+	if !strings.Contains(html, "&lt;script&gt;") {
+		t.Error("escaped guest name not found in the html email")
+	}
+	if !strings.Contains(text, `Dear <script>alert("hi")</script>,`) {
+		t.Errorf("plain text email should contain the name as typed, got:\n%s", text)
+	}
+	if !strings.Contains(text, "Saturday, January 1, 2050") || !strings.Contains(text, "200.00") {
+		t.Errorf("plain text email is missing the stay details, got:\n%s", text)
+	}
+
+	if !strings.Contains(html, "Harbour View Inn") || !strings.HasSuffix(text, "--\nHarbour View Inn\n") {
+		t.Errorf("emails should be signed with the property name, got:\n%s", text)
+	}
+
+	_, _, err = Email("no-such-email", &models.EmailData{})
+	if err == nil {
+		t.Error("expected an error for an unknown email template")
+	}
+}
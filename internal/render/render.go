@@ -4,6 +4,8 @@ import (
 	"bookings/internal/config"
 	"bookings/internal/helpers"
 	"bookings/internal/models"
+	"bookings/internal/permission"
+	"bookings/internal/pricing"
 	"bytes"
 	"errors"
 	"fmt"
@@ -15,10 +17,14 @@ import (
 )
 
 var functions = template.FuncMap{
-	"humanDate":  helpers.ConvertDateToString,
-	"formatDate": helpers.FormatDate,
-	"iterate":    helpers.Iterate,
-	"add":        helpers.Add,
+	"humanDate":    helpers.ConvertDateToString,
+	"formatDate":   helpers.FormatDate,
+	"iterate":      helpers.Iterate,
+	"add":          helpers.Add,
+	"money":        pricing.FormatAmount,
+	"nextStatuses": models.NextStatuses,
+	"can":          permission.Can,
+	"roleName":     permission.RoleName,
 }
 
 var app *config.AppConfig
@@ -40,6 +46,9 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	} else {
 		td.IsAuthenticated = false
 	}
+	if user, ok := helpers.CurrentUser(r); ok {
+		td.AccessLevel = user.AccessLevel
+	}
 	return td
 }
 
@@ -0,0 +1,93 @@
+package dbrepo
+
+import (
+	"bookings/internal/audit"
+	"bookings/internal/models"
+	"bookings/internal/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WithActor returns a repository recording the changes actor makes through it in the audit log. Each
+// change and its audit event are written in one transaction, so neither is saved without the other.
+func (m *postgresDBRepo) WithActor(actor models.AuditActor) repository.DatabaseRepo {
+	audited := *m
+	audited.actor = &actor
+	return &audited
+}
+
+// audit adds a change to the audit log inside tx, when the repository acts for a user
+func (m *postgresDBRepo) audit(ctx context.Context, tx *sql.Tx, action, entity string, entityID int, before, after interface{}) error {
+	if m.actor == nil {
+		return nil
+	}
+
+	b, a, err := audit.Diff(before, after)
+	if err == nil {
+		err = insertAuditEvent(ctx, tx, models.AuditEvent{
+			UserID:    m.actor.UserID,
+			Action:    action,
+			Entity:    entity,
+			EntityID:  entityID,
+			Before:    b,
+			After:     a,
+			IPAddress: m.actor.IPAddress,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("cannot audit %s of %s %d: %w", action, entity, entityID, err)
+	}
+	return nil
+}
+
+// auditedBlock is what the audit log records of a block, the night it covers
+func auditedBlock(startDate time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"StartDate": startDate.Format("2006-01-02"),
+	}
+}
+
+// auditedStayRule is what the audit log records of a stay rule, with its dates as days
+func auditedStayRule(rule models.StayRule) map[string]interface{} {
+	return map[string]interface{}{
+		"RoomID":            rule.RoomID,
+		"StartDate":         rule.StartDate.Format("2006-01-02"),
+		"EndDate":           rule.EndDate.Format("2006-01-02"),
+		"MinNights":         rule.MinNights,
+		"MaxNights":         rule.MaxNights,
+		"ClosedToArrival":   rule.ClosedToArrival,
+		"ClosedToDeparture": rule.ClosedToDeparture,
+	}
+}
+
+// auditedUser is what the audit log records of a user, leaving out the password and two-factor secret
+func auditedUser(u models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"FirstName":    u.FirstName,
+		"LastName":     u.LastName,
+		"Email":        u.Email,
+		"AccessLevel":  u.AccessLevel,
+		"Active":       u.Active,
+		"TOTPRequired": u.TOTPRequired,
+	}
+}
+
+// auditedWebhook is what the audit log records of a webhook, leaving out the signing secret
+func auditedWebhook(hook models.Webhook) map[string]interface{} {
+	return map[string]interface{}{
+		"URL":    hook.URL,
+		"Events": hook.Events,
+		"Active": hook.Active,
+	}
+}
+
+// auditedICalFeed is what the audit log records of an external calendar, leaving out the URL as
+// calendar exports usually carry their access token in it
+func auditedICalFeed(feed models.ICalFeed) map[string]interface{} {
+	return map[string]interface{}{
+		"RoomID": feed.RoomID,
+		"Name":   feed.Name,
+	}
+}
@@ -2,13 +2,29 @@ package dbrepo
 
 import (
 	"bookings/internal/config"
+	"bookings/internal/helpers"
+	"bookings/internal/models"
 	"bookings/internal/repository"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// exclusionViolation is the Postgres error code raised by the room_restrictions_no_overlap constraint
+const exclusionViolation = "23P01"
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
+	// actor is the user whose changes are recorded in the audit log, nil outside the admin area
+	actor *models.AuditActor
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -17,3 +33,402 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 		DB:  conn,
 	}
 }
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scanRoom scans a rooms row selected with all of its columns
+func scanRoom(row rowScanner) (models.Room, error) {
+	var room models.Room
+	var images, amenities string
+
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.Slug,
+		&room.Description,
+		&images,
+		&room.Capacity,
+		&amenities,
+		&room.NightlyRate,
+		&room.WeekendUplift,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+	if err != nil {
+		return room, err
+	}
+
+	room.Images = helpers.SplitLines(images)
+	room.Amenities = helpers.SplitLines(amenities)
+
+	return room, nil
+}
+
+// joinLines stores a list as newline separated text
+func joinLines(items []string) string {
+	return strings.Join(items, "\n")
+}
+
+// encodePriceLines stores the nightly breakdown of a reservation as JSON
+func encodePriceLines(lines []models.QuoteLine) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	out, err := json.Marshal(lines)
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// decodePriceLines reads the nightly breakdown of a reservation, ignoring malformed data
+func decodePriceLines(s string) []models.QuoteLine {
+	var lines []models.QuoteLine
+	if s == "" {
+		return lines
+	}
+	_ = json.Unmarshal([]byte(s), &lines)
+	return lines
+}
+
+// joinWeekdays stores weekdays as a comma separated list of numbers, Sunday being 0
+func joinWeekdays(days []time.Weekday) string {
+	var items []string
+	for _, d := range days {
+		items = append(items, strconv.Itoa(int(d)))
+	}
+	return strings.Join(items, ",")
+}
+
+// splitWeekdays reads weekdays stored by joinWeekdays
+func splitWeekdays(s string) []time.Weekday {
+	var days []time.Weekday
+	for _, item := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err == nil && n >= 0 && n <= 6 {
+			days = append(days, time.Weekday(n))
+		}
+	}
+	return days
+}
+
+// overlapError turns a violation of the room_restrictions_no_overlap constraint into ErrRoomNotAvailable
+func overlapError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+		return repository.ErrRoomNotAvailable
+	}
+	return err
+}
+
+// reservationColumns selects every column read by scanReservation from reservations r joined with rooms rm
+const reservationColumns = `r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+			  r.room_id, r.created_at, r.updated_at, r.status, r.confirmed_at, r.checked_in_at, r.checked_out_at,
+			  r.cancelled_at, r.no_show_at, r.total_price, r.price_breakdown, r.cancellation_fee, r.ical_sequence,
+			  rm.id, rm.room_name`
+
+// scanReservation scans a row selected with reservationColumns
+func scanReservation(row rowScanner) (models.Reservation, error) {
+	var res models.Reservation
+	var confirmedAt, checkedInAt, checkedOutAt, cancelledAt, noShowAt sql.NullTime
+	var priceBreakdown string
+
+	err := row.Scan(
+		&res.ID,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.StartDate,
+		&res.EndDate,
+		&res.RoomID,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+		&res.Status,
+		&confirmedAt,
+		&checkedInAt,
+		&checkedOutAt,
+		&cancelledAt,
+		&noShowAt,
+		&res.TotalPrice,
+		&priceBreakdown,
+		&res.CancellationFee,
+		&res.Sequence,
+		&res.Room.ID,
+		&res.Room.RoomName,
+	)
+	if err != nil {
+		return res, err
+	}
+
+	res.ConfirmedAt = confirmedAt.Time
+	res.CheckedInAt = checkedInAt.Time
+	res.CheckedOutAt = checkedOutAt.Time
+	res.CancelledAt = cancelledAt.Time
+	res.NoShowAt = noShowAt.Time
+	res.PriceLines = decodePriceLines(priceBreakdown)
+
+	return res, nil
+}
+
+// outboxColumns are the email_outbox columns read by scanOutboxEmail
+const outboxColumns = `id, to_address, from_address, subject, content, plain_text, attachments, status, attempts,
+	next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+// scanOutboxEmail scans an email_outbox row selected with outboxColumns
+func scanOutboxEmail(row rowScanner) (models.OutboxEmail, error) {
+	var e models.OutboxEmail
+	var sentAt sql.NullTime
+	var attachments string
+
+	err := row.Scan(
+		&e.ID,
+		&e.Mail.To,
+		&e.Mail.From,
+		&e.Mail.Subject,
+		&e.Mail.Content,
+		&e.Mail.PlainText,
+		&attachments,
+		&e.Status,
+		&e.Attempts,
+		&e.NextAttemptAt,
+		&e.LastError,
+		&sentAt,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return e, err
+	}
+
+	e.SentAt = sentAt.Time
+
+	if attachments != "" {
+		err = json.Unmarshal([]byte(attachments), &e.Mail.Attachments)
+		if err != nil {
+			return e, err
+		}
+	}
+
+	return e, nil
+}
+
+// icalFeedColumns selects every column read by scanICalFeed from ical_feeds f joined with rooms rm
+const icalFeedColumns = `f.id, f.room_id, f.name, f.url, f.last_synced_at, f.last_status, f.last_error,
+			  f.event_count, f.created_at, f.updated_at, coalesce(rm.room_name, '')`
+
+// scanICalFeed scans a row selected with icalFeedColumns
+func scanICalFeed(row rowScanner) (models.ICalFeed, error) {
+	var feed models.ICalFeed
+	var lastSyncedAt sql.NullTime
+
+	err := row.Scan(
+		&feed.ID,
+		&feed.RoomID,
+		&feed.Name,
+		&feed.URL,
+		&lastSyncedAt,
+		&feed.LastStatus,
+		&feed.LastError,
+		&feed.EventCount,
+		&feed.CreatedAt,
+		&feed.UpdatedAt,
+		&feed.Room.RoomName,
+	)
+	if err != nil {
+		return feed, err
+	}
+
+	feed.LastSyncedAt = lastSyncedAt.Time
+	feed.Room.ID = feed.RoomID
+
+	return feed, nil
+}
+
+// apiTokenColumns selects every column read by scanAPIToken from api_tokens t joined with users u
+const apiTokenColumns = `t.id, t.user_id, t.name, t.display, t.token_hash, t.scope, t.expires_at, t.last_used_at,
+			  t.created_at, t.updated_at, u.first_name, u.last_name, u.email, u.access_level, u.active`
+
+// scanAPIToken scans a row selected with apiTokenColumns
+func scanAPIToken(row rowScanner) (models.APIToken, error) {
+	var token models.APIToken
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Display,
+		&token.TokenHash,
+		&token.Scope,
+		&token.ExpiresAt,
+		&lastUsedAt,
+		&token.CreatedAt,
+		&token.UpdatedAt,
+		&token.User.FirstName,
+		&token.User.LastName,
+		&token.User.Email,
+		&token.User.AccessLevel,
+		&token.User.Active,
+	)
+	if err != nil {
+		return token, err
+	}
+
+	token.LastUsedAt = lastUsedAt.Time
+	token.User.ID = token.UserID
+
+	return token, nil
+}
+
+// webhookColumns are the webhooks columns read by scanWebhook
+const webhookColumns = `id, url, secret, events, active, created_at, updated_at`
+
+// scanWebhook scans a webhooks row selected with webhookColumns
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var events string
+
+	err := row.Scan(
+		&hook.ID,
+		&hook.URL,
+		&hook.Secret,
+		&events,
+		&hook.Active,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	)
+	if err != nil {
+		return hook, err
+	}
+
+	hook.Events = splitEvents(events)
+
+	return hook, nil
+}
+
+// joinEvents stores webhook events as a comma separated list
+func joinEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+// splitEvents reads webhook events stored by joinEvents
+func splitEvents(s string) []string {
+	var events []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// webhookDeliveryColumns selects every column read by scanWebhookDelivery from webhook_deliveries d
+// joined with webhooks w
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+			  d.response_status, d.last_error, d.delivered_at, d.created_at, d.updated_at, w.url, w.secret`
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.ResponseStatus,
+		&d.LastError,
+		&deliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Webhook.URL,
+		&d.Webhook.Secret,
+	)
+	if err != nil {
+		return d, err
+	}
+
+	d.DeliveredAt = deliveredAt.Time
+	d.Webhook.ID = d.WebhookID
+
+	return d, nil
+}
+
+// userColumns selects every column read by scanUser from users
+const userColumns = `id, first_name, last_name, email, password, access_level, active, session_version,
+			  totp_secret, totp_last_step, totp_required, created_at, updated_at`
+
+// scanUser scans a users row selected with userColumns
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password,
+		&user.AccessLevel,
+		&user.Active,
+		&user.SessionVersion,
+		&user.TOTPSecret,
+		&user.TOTPLastStep,
+		&user.TOTPRequired,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	return user, err
+}
+
+// userSessionColumns selects every column read by scanUserSession from user_sessions
+const userSessionColumns = `id, user_id, token, ip_address, user_agent, last_seen_at, created_at, updated_at`
+
+// scanUserSession scans a user_sessions row selected with userSessionColumns
+func scanUserSession(row rowScanner) (models.UserSession, error) {
+	var s models.UserSession
+
+	err := row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.Token,
+		&s.IPAddress,
+		&s.UserAgent,
+		&s.LastSeenAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+
+	return s, err
+}
+
+// passwordCost is the bcrypt cost of stored passwords, the same as the seeded admin's
+const passwordCost = 12
+
+// hashPassword hashes a password for storage, to be checked by Authenticate
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -2,16 +2,47 @@ package dbrepo
 
 import (
 	"bookings/internal/models"
+	"bookings/internal/repository"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
+// AllUsers returns all users, ordered by name
+func (m *postgresDBRepo) AllUsers() ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var users []models.User
+
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY last_name, first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
 }
 
 // InsertReservation inserts a reservation into the database
@@ -22,8 +53,8 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 	var newID int
 
 	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, 
-			end_date, room_id, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+			end_date, room_id, total_price, price_breakdown, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
 
 	err := m.DB.QueryRowContext(ctx, stmt,
 		res.FirstName,
@@ -33,6 +64,8 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		res.TotalPrice,
+		encodePriceLines(res.PriceLines),
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -70,6 +103,105 @@ func (m *postgresDBRepo) InsertRoomRestriction(res models.RoomRestriction) error
 	return nil
 }
 
+// CreateBooking inserts a reservation and its room restriction in one transaction. The room row is
+// locked while availability is checked again, so concurrent bookings of the same room are serialized,
+// and ErrRoomNotAvailable is returned when the dates have been taken in the meantime. When confirmation
+// is given, the email it builds for the new reservation id is queued in the outbox by the same transaction,
+// and so is the webhook message publish builds for the new reservation.
+func (m *postgresDBRepo) CreateBooking(res models.Reservation, confirmation func(id int) (models.MailData, error), publish func(res models.Reservation) (models.WebhookMessage, error)) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	var numRows int
+
+	query := `SELECT count(id) FROM room_restrictions
+			  WHERE room_id = $1 AND $2 < end_date AND $3 > start_date`
+
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+
+	if numRows > 0 {
+		return 0, repository.ErrRoomNotAvailable
+	}
+
+	var newID int
+
+	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, 
+			end_date, room_id, total_price, price_breakdown, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		res.TotalPrice,
+		encodePriceLines(res.PriceLines),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, 
+			restriction_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		newID,
+		1,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, overlapError(err)
+	}
+
+	if confirmation != nil {
+		msg, err := confirmation(newID)
+		if err != nil {
+			return 0, err
+		}
+
+		err = queueEmail(ctx, tx, msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = publishReservation(ctx, tx, newID, publish)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, overlapError(err)
+	}
+
+	return newID, nil
+}
+
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
 func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -103,7 +235,7 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	query := `SELECT r.id, r.room_name FROM rooms r
 			  WHERE r.id NOT IN	
 			  (SELECT rr.room_id FROM room_restrictions rr
-			  WHERE	$1 <= end_date AND $2 >= start_date)`
+			  WHERE	rr.start_date < $2 AND rr.end_date > $1)`
 
 	rows, err := m.DB.QueryContext(ctx, query, start, end)
 	if err != nil {
@@ -132,22 +264,30 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var room models.Room
+	return getRoom(ctx, m.DB, id)
+}
 
-	query := `SELECT id, room_name, created_at, updated_at FROM rooms WHERE id = $1`
+// getRoom reads a room by id through db, which may be a transaction
+func getRoom(ctx context.Context, db queryRower, id int) (models.Room, error) {
+	query := `SELECT id, room_name, slug, description, images, capacity, amenities, nightly_rate, weekend_uplift,
+			  created_at, updated_at
+			  FROM rooms WHERE id = $1`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
-	if err != nil {
-		return room, err
-	}
+	row := db.QueryRowContext(ctx, query, id)
+	return scanRoom(row)
+}
+
+// GetRoomBySlug gets a room by its URL slug
+func (m *postgresDBRepo) GetRoomBySlug(slug string) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	return room, nil
+	query := `SELECT id, room_name, slug, description, images, capacity, amenities, nightly_rate, weekend_uplift,
+			  created_at, updated_at
+			  FROM rooms WHERE slug = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, slug)
+	return scanRoom(row)
 }
 
 // GetUserByID returns a user by ID
@@ -155,27 +295,15 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var user models.User
-
-	query := `SELECT id, first_name, last_name, email, password, access_level, created_at, updated_at 
-			  FROM userss WHERE id = $1`
+	return getUser(ctx, m.DB, id)
+}
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.AccessLevel,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err != nil {
-		return user, err
-	}
+// getUser reads a user by id through db, which may be a transaction
+func getUser(ctx context.Context, db queryRower, id int) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
-	return user, nil
+	row := db.QueryRowContext(ctx, query, id)
+	return scanUser(row)
 }
 
 // UpdateUser updates a user in the database
@@ -183,347 +311,2726 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getUser(ctx, tx, u.ID)
+	if err != nil {
+		return err
+	}
+
 	query := `UPDATE users
 			  SET 
 			  	first_name = $2, 
 			  	last_name = $3, 
 				email = $4, 
 				access_level = $5,
-				updated_at = $6
+				active = $6,
+				totp_required = $7,
+				updated_at = $8
 			  WHERE id = $1`
 
-	_, err := m.DB.ExecContext(ctx, query, u.ID, u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now())
+	_, err = tx.ExecContext(ctx, query, u.ID, u.FirstName, u.LastName, u.Email, u.AccessLevel, u.Active,
+		u.TOTPRequired, time.Now())
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// Authenticate authenticates a user
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `SELECT id, password FROM users
-			  WHERE email = $1`
-
-	var id int
-	var hashedPassword string
-
-	row := m.DB.QueryRowContext(ctx, query, email)
-	err := row.Scan(&id, &hashedPassword)
+	after, err := getUser(ctx, tx, u.ID)
 	if err != nil {
-		return id, "", err
+		return err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
-
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return id, "", errors.New("incorrect credentials")
-	} else if err != nil {
-		return id, "", err
+	err = m.audit(ctx, tx, models.AuditUserUpdated, models.AuditEntityUser, u.ID, auditedUser(before), auditedUser(after))
+	if err != nil {
+		return err
 	}
 
-	return id, hashedPassword, nil
+	return tx.Commit()
 }
 
-// AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+// InsertUser inserts a user without a password and returns its id
+func (m *postgresDBRepo) InsertUser(u models.User) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var reservations []models.Reservation
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-			  r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name	
-			  FROM reservations r 
-			  LEFT JOIN rooms rm ON (r.room_id = rm.id)
-			  ORDER BY r.start_date asc`
+	var newID int
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	stmt := `INSERT INTO users (first_name, last_name, email, password, access_level, active, created_at, updated_at)
+			 VALUES ($1, $2, $3, '', $4, true, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		u.AccessLevel,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
 	if err != nil {
-		return reservations, err
+		return 0, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var res models.Reservation
-		err := rows.Scan(
-			&res.ID,
-			&res.FirstName,
-			&res.LastName,
-			&res.Email,
-			&res.Phone,
-			&res.StartDate,
-			&res.EndDate,
-			&res.RoomID,
-			&res.CreatedAt,
-			&res.UpdatedAt,
-			&res.Processed,
-			&res.Room.ID,
-			&res.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
+	after, err := getUser(ctx, tx, newID)
+	if err != nil {
+		return 0, err
+	}
 
-		reservations = append(reservations, res)
+	err = m.audit(ctx, tx, models.AuditUserCreated, models.AuditEntityUser, newID, nil, auditedUser(after))
+	if err != nil {
+		return 0, err
 	}
 
-	if err = rows.Err(); err != nil {
-		log.Fatal("Error scanning rows", err)
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
 	}
-	return reservations, nil
+
+	return newID, nil
 }
 
-// NewReservations returns a slice of new reservations
-func (m *postgresDBRepo) NewReservations() ([]models.Reservation, error) {
+// GetUserByEmail returns a user by email address
+func (m *postgresDBRepo) GetUserByEmail(email string) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var reservations []models.Reservation
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-			  r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name	
-			  FROM reservations r 
-			  LEFT JOIN rooms rm ON (r.room_id = rm.id)
-			  WHERE processed = 0
-			  ORDER BY r.start_date asc`
+	row := m.DB.QueryRowContext(ctx, query, email)
+	return scanUser(row)
+}
 
-	rows, err := m.DB.QueryContext(ctx, query)
+// InsertUserToken inserts a one-time token, replacing any unused token the user has for the same purpose
+func (m *postgresDBRepo) InsertUserToken(t models.UserToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return reservations, err
+		return 0, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	for rows.Next() {
-		var res models.Reservation
-		err := rows.Scan(
-			&res.ID,
-			&res.FirstName,
-			&res.LastName,
-			&res.Email,
-			&res.Phone,
-			&res.StartDate,
-			&res.EndDate,
-			&res.RoomID,
-			&res.CreatedAt,
-			&res.UpdatedAt,
-			&res.Processed,
-			&res.Room.ID,
-			&res.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
+	_, err = tx.ExecContext(ctx, `UPDATE user_tokens SET used_at = $3, updated_at = $3
+			  WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, t.UserID, t.Purpose, time.Now())
+	if err != nil {
+		return 0, err
+	}
 
-		reservations = append(reservations, res)
+	var newID int
+
+	stmt := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		t.UserID,
+		t.Purpose,
+		t.TokenHash,
+		t.ExpiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
 	}
 
-	if err = rows.Err(); err != nil {
-		log.Fatal("Error scanning rows", err)
+	if err = tx.Commit(); err != nil {
+		return 0, err
 	}
-	return reservations, nil
+
+	return newID, nil
 }
 
-// GetReservationByID returns the reservation extracted by id
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+// GetUserTokenByHash gets an unused and unexpired token for purpose, with the user it belongs to
+func (m *postgresDBRepo) GetUserTokenByHash(purpose, hash string) (models.UserToken, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var reservation models.Reservation
-
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-			  r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name	
-			  FROM reservations r 
-			  LEFT JOIN rooms rm ON (r.room_id = rm.id)
-			  WHERE r.id = $1`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&reservation.ID,
-		&reservation.FirstName,
-		&reservation.LastName,
-		&reservation.Email,
-		&reservation.Phone,
-		&reservation.StartDate,
-		&reservation.EndDate,
-		&reservation.RoomID,
-		&reservation.CreatedAt,
-		&reservation.UpdatedAt,
-		&reservation.Processed,
-		&reservation.Room.ID,
-		&reservation.Room.RoomName,
+	var t models.UserToken
+
+	query := `SELECT t.id, t.user_id, t.purpose, t.token_hash, t.expires_at, t.created_at, t.updated_at,
+			  u.first_name, u.last_name, u.email, u.access_level, u.active
+			  FROM user_tokens t
+			  JOIN users u ON (t.user_id = u.id)
+			  WHERE t.token_hash = $1 AND t.purpose = $2 AND t.used_at IS NULL AND t.expires_at > $3`
+
+	err := m.DB.QueryRowContext(ctx, query, hash, purpose, time.Now()).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Purpose,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.User.FirstName,
+		&t.User.LastName,
+		&t.User.Email,
+		&t.User.AccessLevel,
+		&t.User.Active,
 	)
 	if err != nil {
-		return reservation, err
+		return t, err
 	}
 
-	return reservation, nil
+	t.User.ID = t.UserID
+
+	return t, nil
 }
 
-// UpdateReservation updates a reservation in the database
-func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
+// SetPasswordWithToken uses up a one-time token for purpose and sets the password of its user,
+// returning the user's id. The user's existing sessions and trusted devices stop working. A token
+// that is used or expired gives repository.ErrInvalidUserToken.
+func (m *postgresDBRepo) SetPasswordWithToken(purpose, hash, password string) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `UPDATE reservations
-			  SET 
-			  	first_name = $2, 
-			  	last_name = $3, 
-				email = $4, 
-				phone = $5,
-				updated_at = $6,
-				processed = $7
-			  WHERE id = $1`
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, r.ID, r.FirstName, r.LastName, r.Email, r.Phone, time.Now(), r.Processed)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	return nil
-}
+	var tokenID, userID int
 
-// DeleteReservation deletes one reservation by id
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	query := `SELECT id, user_id FROM user_tokens
+			  WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+			  FOR UPDATE`
 
-	query := `DELETE FROM reservations  WHERE id = $1`
+	err = tx.QueryRowContext(ctx, query, hash, purpose, time.Now()).Scan(&tokenID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrInvalidUserToken
+	} else if err != nil {
+		return 0, err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err = tx.ExecContext(ctx, `UPDATE user_tokens SET used_at = $2, updated_at = $2 WHERE id = $1`,
+		tokenID, time.Now())
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
-}
-
-// UpdateProcessedForReservation updates processed for a reservation by id
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	_, err = tx.ExecContext(ctx, `UPDATE users
+			  SET password = $2, session_version = session_version + 1, updated_at = $3
+			  WHERE id = $1`,
+		userID, hashedPassword, time.Now())
+	if err != nil {
+		return 0, err
+	}
 
-	query := `UPDATE reservations SET updated_at = $2, processed = $3 WHERE id = $1`
+	_, err = tx.ExecContext(ctx, `DELETE FROM trusted_devices WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, id, time.Now(), processed)
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userID)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// EnableTOTP turns on two-factor authentication for a user with a confirmed secret, the time step of
+// the code that confirmed it and a new set of recovery codes
+func (m *postgresDBRepo) EnableTOTP(userID int, secret string, step int64, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET totp_secret = $2, totp_last_step = $3, updated_at = $4
+			  WHERE id = $1`, userID, secret, step, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication for a user, removing their recovery codes and
+// trusted devices
+func (m *postgresDBRepo) DisableTOTP(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET totp_secret = '', totp_last_step = 0, updated_at = $2
+			  WHERE id = $1`, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM trusted_devices WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of a two-factor code a user logged in with. It reports false if a
+// code from this step or a later one was already used, so each code works only once.
+func (m *postgresDBRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE users SET totp_last_step = $2
+			  WHERE id = $1 AND totp_last_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user
+func (m *postgresDBRepo) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and inserts the given ones
+func replaceRecoveryCodes(ctx context.Context, db execer, userID int, codeHashes []string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO recovery_codes (user_id, code_hash, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4)`
+
+	for _, hash := range codeHashes {
+		_, err = db.ExecContext(ctx, stmt, userID, hash, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// AllRooms returns all rooms
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
+// RecoveryCodesLeft returns how many unused recovery codes a user has
+func (m *postgresDBRepo) RecoveryCodesLeft(userID int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var rooms []models.Room
+	var count int
 
-	query := `SELECT id, room_name, created_at, updated_at FROM rooms ORDER BY room_name`
+	query := `SELECT count(id) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
 	if err != nil {
-		return rooms, err
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, reporting false if there is none
+func (m *postgresDBRepo) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE recovery_codes SET used_at = $3, updated_at = $3
+			  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// InsertTrustedDevice inserts a trusted device and returns its id
+func (m *postgresDBRepo) InsertTrustedDevice(d models.TrustedDevice) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `INSERT INTO trusted_devices (user_id, token_hash, user_agent, expires_at, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		d.UserID,
+		d.TokenHash,
+		d.UserAgent,
+		d.ExpiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// IsTrustedDevice reports whether a token hash belongs to an unexpired trusted device of the user
+func (m *postgresDBRepo) IsTrustedDevice(userID int, tokenHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	query := `SELECT count(id) FROM trusted_devices
+			  WHERE user_id = $1 AND token_hash = $2 AND expires_at > $3`
+
+	err := m.DB.QueryRowContext(ctx, query, userID, tokenHash, time.Now()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// TrustedDevicesForUser returns the unexpired trusted devices of a user, newest first
+func (m *postgresDBRepo) TrustedDevicesForUser(userID int) ([]models.TrustedDevice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var devices []models.TrustedDevice
+
+	query := `SELECT id, user_id, token_hash, user_agent, expires_at, created_at, updated_at
+			  FROM trusted_devices
+			  WHERE user_id = $1 AND expires_at > $2
+			  ORDER BY created_at DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return devices, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var room models.Room
+		var d models.TrustedDevice
 		err := rows.Scan(
-			&room.ID,
-			&room.RoomName,
-			&room.CreatedAt,
-			&room.UpdatedAt,
+			&d.ID,
+			&d.UserID,
+			&d.TokenHash,
+			&d.UserAgent,
+			&d.ExpiresAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
 		)
 		if err != nil {
-			return rooms, err
+			return devices, err
 		}
+		devices = append(devices, d)
+	}
 
-		rooms = append(rooms, room)
+	if err = rows.Err(); err != nil {
+		return devices, err
+	}
+
+	return devices, nil
+}
+
+// DeleteTrustedDevices forgets all trusted devices of a user, who is asked for a code at the next login
+func (m *postgresDBRepo) DeleteTrustedDevices(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM trusted_devices WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertLoginFailure records a failed login attempt
+func (m *postgresDBRepo) InsertLoginFailure(f models.LoginFailure) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `INSERT INTO login_failures (email, ip_address, user_agent, reason, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		f.Email,
+		f.IPAddress,
+		f.UserAgent,
+		f.Reason,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LoginFailureCounts returns the counted failures since a time for an account and for an IP address.
+// Cleared failures and attempts refused by the throttle are not counted.
+func (m *postgresDBRepo) LoginFailureCounts(email, ip string, since time.Time) (models.LoginCounts, models.LoginCounts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count := func(column, value string) (models.LoginCounts, error) {
+		var counts models.LoginCounts
+		var last sql.NullTime
+
+		query := `SELECT count(id), max(created_at) FROM login_failures
+				  WHERE ` + column + ` = $1 AND created_at > $2 AND NOT cleared AND reason <> $3`
+
+		err := m.DB.QueryRowContext(ctx, query, value, since, models.LoginFailureThrottled).
+			Scan(&counts.Failures, &last)
+		counts.Last = last.Time
+		return counts, err
+	}
+
+	account, err := count("email", email)
+	if err != nil {
+		return account, models.LoginCounts{}, err
+	}
+
+	byIP, err := count("ip_address", ip)
+	if err != nil {
+		return account, byIP, err
+	}
+
+	return account, byIP, nil
+}
+
+// ClearLoginFailures stops the failures of an account from counting, after a successful login or
+// when an admin unlocks it
+func (m *postgresDBRepo) ClearLoginFailures(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE login_failures SET cleared = true, updated_at = $2
+			  WHERE email = $1 AND NOT cleared`, email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LockedAccounts returns the accounts with at least threshold counted failures since a time
+func (m *postgresDBRepo) LockedAccounts(since time.Time, threshold int) ([]models.LockedAccount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var accounts []models.LockedAccount
+
+	query := `SELECT email, count(id), max(created_at) FROM login_failures
+			  WHERE created_at > $1 AND NOT cleared AND reason <> $2
+			  GROUP BY email
+			  HAVING count(id) >= $3
+			  ORDER BY max(created_at) DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, since, models.LoginFailureThrottled, threshold)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.LockedAccount
+		err := rows.Scan(&a.Email, &a.Failures, &a.Last)
+		if err != nil {
+			return accounts, err
+		}
+		accounts = append(accounts, a)
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Fatal("Error scanning rows", err)
+		return accounts, err
 	}
 
-	return rooms, nil
+	return accounts, nil
 }
 
-// GetRestrictionsForRoomByDate returns restrictions for a room by date range
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+// RecentLoginFailures returns the latest failed login attempts, newest first
+func (m *postgresDBRepo) RecentLoginFailures(limit int) ([]models.LoginFailure, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var restrictions []models.RoomRestriction
+	var failures []models.LoginFailure
 
-	query := `SELECT id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
-			  FROM room_restrictions
-			  WHERE $2 <= end_date AND $3 >= start_date AND room_id = $1`
+	query := `SELECT id, email, ip_address, user_agent, reason, cleared, created_at, updated_at
+			  FROM login_failures
+			  ORDER BY created_at DESC
+			  LIMIT $1`
 
-	rows, err := m.DB.QueryContext(ctx, query, roomID, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, limit)
 	if err != nil {
-		return nil, err
+		return failures, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var r models.RoomRestriction
+		var f models.LoginFailure
 		err := rows.Scan(
-			&r.ID,
-			&r.ReservationID,
-			&r.RestrictionID,
-			&r.RoomID,
-			&r.StartDate,
-			&r.EndDate,
+			&f.ID,
+			&f.Email,
+			&f.IPAddress,
+			&f.UserAgent,
+			&f.Reason,
+			&f.Cleared,
+			&f.CreatedAt,
+			&f.UpdatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return failures, err
 		}
-
-		restrictions = append(restrictions, r)
+		failures = append(failures, f)
 	}
 
 	if err = rows.Err(); err != nil {
+		return failures, err
+	}
+
+	return failures, nil
+}
+
+// FindSession returns the data of an unexpired session, or sql.ErrNoRows
+func (m *postgresDBRepo) FindSession(token string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var data []byte
+
+	query := `SELECT data FROM sessions WHERE token = $1 AND expiry > $2`
+
+	err := m.DB.QueryRowContext(ctx, query, token, time.Now()).Scan(&data)
+	if err != nil {
 		return nil, err
 	}
 
-	return restrictions, nil
+	return data, nil
 }
 
-// InsertBlockForRoom inserts a block restriction for a room by id and date
-func (m *postgresDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) error {
+// CommitSession stores the data of a session, adding it if it is new
+func (m *postgresDBRepo) CommitSession(token string, data []byte, expiry time.Time) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `INSERT INTO room_restrictions 
-			  (start_date, end_date, room_id, restriction_id, created_at, updated_at)
-			  VALUES ($1, $2, $3, $4, $5, $6)`
+	stmt := `INSERT INTO sessions (token, data, expiry, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (token) DO UPDATE SET data = excluded.data, expiry = excluded.expiry,
+			 updated_at = excluded.updated_at`
 
-	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), roomID, 2, time.Now(), time.Now())
+	_, err := m.DB.ExecContext(ctx, stmt, token, data, expiry, time.Now(), time.Now())
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
 	return nil
 }
 
-// DeleteRoomRestrictionByID deletes room restriction by id
-func (m *postgresDBRepo) DeleteRoomRestrictionByID(id int) error {
+// DeleteSession removes a session
+func (m *postgresDBRepo) DeleteSession(token string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `DELETE FROM room_restrictions WHERE id = $1`
-
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE token = $1`, token)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
 	return nil
 }
+
+// DeleteExpiredSessions removes the expired sessions, and the user sessions left without one, and
+// returns how many sessions there were
+func (m *postgresDBRepo) DeleteExpiredSessions() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expiry <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// user sessions are recorded just before their session is first stored, so recent ones are kept
+	stmt := `DELETE FROM user_sessions us
+			 WHERE us.created_at < $1 AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.token = us.token)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, time.Now().Add(-time.Minute))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// DeleteUserSessionsStartedBefore removes the user sessions started before t, whose session has expired
+// whichever store keeps it, and returns how many there were
+func (m *postgresDBRepo) DeleteUserSessionsStartedBefore(t time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM user_sessions WHERE created_at < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// InsertUserSession records a browser where a user logged in
+func (m *postgresDBRepo) InsertUserSession(s models.UserSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `INSERT INTO user_sessions (user_id, token, ip_address, user_agent, last_seen_at, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		s.UserID,
+		s.Token,
+		s.IPAddress,
+		s.UserAgent,
+		s.LastSeenAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetUserSessionByToken returns the user session of a session token, or sql.ErrNoRows if it was signed out
+func (m *postgresDBRepo) GetUserSessionByToken(token string) (models.UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + userSessionColumns + ` FROM user_sessions WHERE token = $1`
+
+	return scanUserSession(m.DB.QueryRowContext(ctx, query, token))
+}
+
+// TouchUserSession records when and from where a session was last used
+func (m *postgresDBRepo) TouchUserSession(id int, ip string, seenAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE user_sessions SET ip_address = $2, last_seen_at = $3, updated_at = $4 WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, stmt, id, ip, seenAt, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UserSessionsForUser returns the sessions of a user started after since, last used first
+func (m *postgresDBRepo) UserSessionsForUser(userID int, since time.Time) ([]models.UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var sessions []models.UserSession
+
+	query := `SELECT ` + userSessionColumns + ` FROM user_sessions
+			  WHERE user_id = $1 AND created_at > $2
+			  ORDER BY last_seen_at DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, since)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanUserSession(rows)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSession removes a session of a user and returns its token, or sql.ErrNoRows if the user
+// has no such session
+func (m *postgresDBRepo) DeleteUserSession(id, userID int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var token string
+
+	stmt := `DELETE FROM user_sessions WHERE id = $1 AND user_id = $2 RETURNING token`
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, userID).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// DeleteUserSessionByToken removes the user session of a session token
+func (m *postgresDBRepo) DeleteUserSessionByToken(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM user_sessions WHERE token = $1`, token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUserSessionsForUser removes all sessions of a user and returns their tokens
+func (m *postgresDBRepo) DeleteUserSessionsForUser(userID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tokens []string
+
+	rows, err := m.DB.QueryContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1 RETURNING token`, userID)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		err := rows.Scan(&token)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+// Authenticate authenticates a user
+func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, password FROM users
+			  WHERE email = $1 AND active`
+
+	var id int
+	var hashedPassword string
+
+	row := m.DB.QueryRowContext(ctx, query, email)
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		return id, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return id, "", errors.New("incorrect credentials")
+	} else if err != nil {
+		return id, "", err
+	}
+
+	return id, hashedPassword, nil
+}
+
+// AllReservations returns a slice of all reservations
+func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r 
+			  LEFT JOIN rooms rm ON (r.room_id = rm.id)
+			  ORDER BY r.start_date asc`
+
+	return m.queryReservations(ctx, query)
+}
+
+// NewReservations returns a slice of new reservations
+func (m *postgresDBRepo) NewReservations() ([]models.Reservation, error) {
+	return m.ReservationsByStatus(models.StatusPending)
+}
+
+// ReservationsByStatus returns a slice of the reservations in a status
+func (m *postgresDBRepo) ReservationsByStatus(status string) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r 
+			  LEFT JOIN rooms rm ON (r.room_id = rm.id)
+			  WHERE r.status = $1
+			  ORDER BY r.start_date asc`
+
+	return m.queryReservations(ctx, query, status)
+}
+
+func (m *postgresDBRepo) queryReservations(ctx context.Context, query string, args ...interface{}) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetReservationByID returns the reservation extracted by id
+func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getReservation(ctx, m.DB, id)
+}
+
+// getReservation reads a reservation by id through db, which may be a transaction
+func getReservation(ctx context.Context, db queryRower, id int) (models.Reservation, error) {
+	query := `SELECT ` + reservationColumns + `
+			  FROM reservations r 
+			  LEFT JOIN rooms rm ON (r.room_id = rm.id)
+			  WHERE r.id = $1`
+
+	row := db.QueryRowContext(ctx, query, id)
+	return scanReservation(row)
+}
+
+// publishReservation queues the webhook message publish builds from the reservation as it is now
+// in tx, so it is sent only if the change is committed. Nothing is queued when publish is nil.
+func publishReservation(ctx context.Context, tx *sql.Tx, id int, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	if publish == nil {
+		return nil
+	}
+
+	res, err := getReservation(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	msg, err := publish(res)
+	if err != nil {
+		return err
+	}
+
+	return queueWebhookMessage(ctx, tx, msg)
+}
+
+// UpdateReservation updates a reservation in the database, queueing the webhook message publish builds
+// in the same transaction
+func (m *postgresDBRepo) UpdateReservation(r models.Reservation, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getReservation(ctx, tx, r.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE reservations
+			  SET 
+			  	first_name = $2, 
+			  	last_name = $3, 
+				email = $4, 
+				phone = $5,
+				updated_at = $6,
+				total_price = $7,
+				ical_sequence = ical_sequence + 1
+			  WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, query, r.ID, r.FirstName, r.LastName, r.Email, r.Phone, time.Now(), r.TotalPrice)
+	if err != nil {
+		return err
+	}
+
+	err = m.auditReservation(ctx, tx, models.AuditReservationUpdated, before)
+	if err != nil {
+		return err
+	}
+
+	err = publishReservation(ctx, tx, r.ID, publish)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteReservation deletes one reservation by id. The webhook message publish builds from the
+// reservation as it was is queued in the same transaction.
+func (m *postgresDBRepo) DeleteReservation(id int, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getReservation(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = publishReservation(ctx, tx, id, publish)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM reservations  WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditReservationDeleted, models.AuditEntityReservation, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// statusTimestampColumns maps a status to the column recording when a reservation entered it
+var statusTimestampColumns = map[string]string{
+	models.StatusConfirmed:  "confirmed_at",
+	models.StatusCheckedIn:  "checked_in_at",
+	models.StatusCheckedOut: "checked_out_at",
+	models.StatusCancelled:  "cancelled_at",
+	models.StatusNoShow:     "no_show_at",
+}
+
+// UpdateReservationStatus moves a reservation to a new status and records when it happened.
+// It returns ErrInvalidStatusTransition if the lifecycle does not allow the move, and releases
+// the room of reservations that are cancelled or marked as no-show. The webhook message publish
+// builds is queued in the same transaction.
+func (m *postgresDBRepo) UpdateReservationStatus(id int, status string, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getReservation(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = updateStatusTx(ctx, tx, id, status)
+	if err != nil {
+		return err
+	}
+
+	err = m.auditReservation(ctx, tx, models.AuditReservationStatus, before)
+	if err != nil {
+		return err
+	}
+
+	err = publishReservation(ctx, tx, id, publish)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelReservation cancels a reservation and records the fee the guest owes for it, queueing the
+// webhook message publish builds in the same transaction
+func (m *postgresDBRepo) CancelReservation(id, fee int, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getReservation(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = updateStatusTx(ctx, tx, id, models.StatusCancelled)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE reservations SET cancellation_fee = $2 WHERE id = $1`, id, fee)
+	if err != nil {
+		return err
+	}
+
+	err = m.auditReservation(ctx, tx, models.AuditReservationCancelled, before)
+	if err != nil {
+		return err
+	}
+
+	err = publishReservation(ctx, tx, id, publish)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// auditReservation records the change of a reservation from before to how it is now in tx
+func (m *postgresDBRepo) auditReservation(ctx context.Context, tx *sql.Tx, action string, before models.Reservation) error {
+	after, err := getReservation(ctx, tx, before.ID)
+	if err != nil {
+		return err
+	}
+
+	return m.audit(ctx, tx, action, models.AuditEntityReservation, before.ID, before, after)
+}
+
+// updateStatusTx performs a status change inside tx, see UpdateReservationStatus
+func updateStatusTx(ctx context.Context, tx *sql.Tx, id int, status string) error {
+	var current string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM reservations WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	if !models.CanTransition(current, status) {
+		return repository.ErrInvalidStatusTransition
+	}
+
+	query := fmt.Sprintf(`UPDATE reservations SET status = $2, %s = $3, updated_at = $3,
+			ical_sequence = ical_sequence + 1 WHERE id = $1`,
+		statusTimestampColumns[status])
+
+	_, err = tx.ExecContext(ctx, query, id, status, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if !models.IsActive(status) {
+		_, err = tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ChangeReservationDates moves a reservation and its room restriction to new dates and price.
+// Like CreateBooking it locks the room, returns ErrRoomNotAvailable if the new dates
+// overlap another reservation or block and queues the webhook message publish builds.
+func (m *postgresDBRepo) ChangeReservationDates(res models.Reservation, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	var numRows int
+
+	query := `SELECT count(id) FROM room_restrictions
+			  WHERE room_id = $1 AND $2 < end_date AND $3 > start_date
+			  AND (reservation_id IS NULL OR reservation_id <> $4)`
+
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate, res.ID).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomNotAvailable
+	}
+
+	stmt := `UPDATE reservations
+			 SET start_date = $2, end_date = $3, total_price = $4, price_breakdown = $5, updated_at = $6,
+			 ical_sequence = ical_sequence + 1
+			 WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		res.ID,
+		res.StartDate,
+		res.EndDate,
+		res.TotalPrice,
+		encodePriceLines(res.PriceLines),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE room_restrictions SET start_date = $2, end_date = $3, updated_at = $4 WHERE reservation_id = $1`
+
+	_, err = tx.ExecContext(ctx, stmt, res.ID, res.StartDate, res.EndDate, time.Now())
+	if err != nil {
+		return overlapError(err)
+	}
+
+	err = publishReservation(ctx, tx, res.ID, publish)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return overlapError(err)
+	}
+
+	return nil
+}
+
+// AllRooms returns all rooms
+func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `SELECT id, room_name, slug, description, images, capacity, amenities, nightly_rate, weekend_uplift,
+			  created_at, updated_at
+			  FROM rooms ORDER BY room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Fatal("Error scanning rows", err)
+	}
+
+	return rooms, nil
+}
+
+// GetRestrictionsForRoomByDate returns restrictions for a room by date range
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.start_date, rr.end_date,
+			  coalesce(r.status, '')
+			  FROM room_restrictions rr
+			  LEFT JOIN reservations r ON (rr.reservation_id = r.id)
+			  WHERE $2 <= rr.end_date AND $3 >= rr.start_date AND rr.room_id = $1`
+
+	return m.queryRestrictions(ctx, query, roomID, start, end)
+}
+
+// GetRestrictionsForRoom returns every restriction of a room, ordered by date
+func (m *postgresDBRepo) GetRestrictionsForRoom(roomID int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.start_date, rr.end_date,
+			  coalesce(r.status, '')
+			  FROM room_restrictions rr
+			  LEFT JOIN reservations r ON (rr.reservation_id = r.id)
+			  WHERE rr.room_id = $1
+			  ORDER BY rr.start_date`
+
+	return m.queryRestrictions(ctx, query, roomID)
+}
+
+func (m *postgresDBRepo) queryRestrictions(ctx context.Context, query string, args ...interface{}) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.Reservation.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// GetRoomICalToken returns the secret token of a room's calendar feed, empty while the feed is disabled
+func (m *postgresDBRepo) GetRoomICalToken(roomID int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var token string
+
+	err := m.DB.QueryRowContext(ctx, `SELECT ical_token FROM rooms WHERE id = $1`, roomID).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// UpdateRoomICalToken replaces the secret token of a room's calendar feed
+func (m *postgresDBRepo) UpdateRoomICalToken(roomID int, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE rooms SET ical_token = $2, updated_at = $3 WHERE id = $1`,
+		roomID, token, time.Now())
+
+	return err
+}
+
+// InsertBlockForRoom inserts a block restriction for a room by id and date. ErrRoomNotAvailable is
+// returned when the night is already reserved or blocked.
+func (m *postgresDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO room_restrictions 
+			  (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), roomID, 2, time.Now(), time.Now())
+	if err != nil {
+		return overlapError(err)
+	}
+
+	err = m.audit(ctx, tx, models.AuditRoomBlocked, models.AuditEntityRoom, roomID, nil, auditedBlock(startDate))
+	if err != nil {
+		return err
+	}
+
+	return overlapError(tx.Commit())
+}
+
+// DeleteRoomRestrictionByID deletes room restriction by id
+func (m *postgresDBRepo) DeleteRoomRestrictionByID(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var roomID int
+	var startDate time.Time
+
+	query := `DELETE FROM room_restrictions WHERE id = $1 RETURNING room_id, start_date`
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&roomID, &startDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditRoomUnblocked, models.AuditEntityRoom, roomID, auditedBlock(startDate), nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertRoom inserts a room into the database
+func (m *postgresDBRepo) InsertRoom(room models.Room) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `INSERT INTO rooms (room_name, slug, description, images, capacity, amenities, nightly_rate,
+			 weekend_uplift, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		joinLines(room.Images),
+		room.Capacity,
+		joinLines(room.Amenities),
+		room.NightlyRate,
+		room.WeekendUplift,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	after, err := getRoom(ctx, tx, newID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.audit(ctx, tx, models.AuditRoomCreated, models.AuditEntityRoom, newID, nil, after)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateRoom updates a room in the database
+func (m *postgresDBRepo) UpdateRoom(room models.Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getRoom(ctx, tx, room.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE rooms
+			  SET
+			  	room_name = $2,
+			  	slug = $3,
+			  	description = $4,
+			  	images = $5,
+			  	capacity = $6,
+			  	amenities = $7,
+			  	nightly_rate = $8,
+			  	weekend_uplift = $9,
+			  	updated_at = $10
+			  WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, query,
+		room.ID,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		joinLines(room.Images),
+		room.Capacity,
+		joinLines(room.Amenities),
+		room.NightlyRate,
+		room.WeekendUplift,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	after, err := getRoom(ctx, tx, room.ID)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditRoomUpdated, models.AuditEntityRoom, room.ID, before, after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRoom deletes a room by id, unless it has any reservations or blocks ending today or later.
+// Reservations are kept as deleting the room would cascade to them. The room is locked like
+// CreateBooking does, so no booking can land between the check and the delete.
+func (m *postgresDBRepo) DeleteRoom(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return err
+	}
+
+	var numRows int
+
+	query := `SELECT (SELECT count(id) FROM reservations WHERE room_id = $1) +
+			  (SELECT count(id) FROM room_restrictions WHERE room_id = $1 AND end_date >= current_date)`
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomInUse
+	}
+
+	before, err := getRoom(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditRoomDeleted, models.AuditEntityRoom, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSeasonalRatesForRoom returns all seasonal rates of a room
+func (m *postgresDBRepo) GetSeasonalRatesForRoom(roomID int) ([]models.SeasonalRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, room_id, name, start_date, end_date, nightly_rate, created_at, updated_at
+			  FROM seasonal_rates
+			  WHERE room_id = $1
+			  ORDER BY start_date`
+
+	return m.querySeasonalRates(ctx, query, roomID)
+}
+
+// GetSeasonalRatesForRoomByDate returns the seasonal rates of a room overlapping a stay from start to end
+func (m *postgresDBRepo) GetSeasonalRatesForRoomByDate(roomID int, start, end time.Time) ([]models.SeasonalRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, room_id, name, start_date, end_date, nightly_rate, created_at, updated_at
+			  FROM seasonal_rates
+			  WHERE room_id = $1 AND $2 <= end_date AND $3 > start_date
+			  ORDER BY start_date`
+
+	return m.querySeasonalRates(ctx, query, roomID, start, end)
+}
+
+func (m *postgresDBRepo) querySeasonalRates(ctx context.Context, query string, args ...interface{}) ([]models.SeasonalRate, error) {
+	var seasons []models.SeasonalRate
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.SeasonalRate
+		err := rows.Scan(
+			&s.ID,
+			&s.RoomID,
+			&s.Name,
+			&s.StartDate,
+			&s.EndDate,
+			&s.NightlyRate,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		seasons = append(seasons, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seasons, nil
+}
+
+// InsertSeasonalRate inserts a seasonal rate into the database
+func (m *postgresDBRepo) InsertSeasonalRate(s models.SeasonalRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+
+	stmt := `INSERT INTO seasonal_rates (room_id, name, start_date, end_date, nightly_rate, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		s.RoomID,
+		s.Name,
+		s.StartDate,
+		s.EndDate,
+		s.NightlyRate,
+		s.CreatedAt,
+		s.UpdatedAt,
+	).Scan(&s.ID)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditSeasonalRateCreated, models.AuditEntitySeasonalRate, s.ID, nil, s)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSeasonalRate deletes a seasonal rate by id, as long as it belongs to the room
+func (m *postgresDBRepo) DeleteSeasonalRate(roomID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM seasonal_rates WHERE id = $1 AND room_id = $2
+			  RETURNING id, room_id, name, start_date, end_date, nightly_rate, created_at, updated_at`
+
+	var s models.SeasonalRate
+	err = tx.QueryRowContext(ctx, query, id, roomID).Scan(
+		&s.ID,
+		&s.RoomID,
+		&s.Name,
+		&s.StartDate,
+		&s.EndDate,
+		&s.NightlyRate,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditSeasonalRateDeleted, models.AuditEntitySeasonalRate, id, s, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AllStayRules returns all stay rules with their room
+func (m *postgresDBRepo) AllStayRules() ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT sr.id, sr.room_id, sr.start_date, sr.end_date, sr.min_nights, sr.max_nights,
+			  sr.closed_to_arrival, sr.closed_to_departure, sr.created_at, sr.updated_at, rm.id, rm.room_name
+			  FROM stay_rules sr
+			  LEFT JOIN rooms rm ON (sr.room_id = rm.id)
+			  ORDER BY rm.room_name, sr.start_date`
+
+	return m.queryStayRules(ctx, query)
+}
+
+// GetStayRulesForRoomByDate returns the stay rules of a room overlapping the dates from start to end
+func (m *postgresDBRepo) GetStayRulesForRoomByDate(roomID int, start, end time.Time) ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT sr.id, sr.room_id, sr.start_date, sr.end_date, sr.min_nights, sr.max_nights,
+			  sr.closed_to_arrival, sr.closed_to_departure, sr.created_at, sr.updated_at, rm.id, rm.room_name
+			  FROM stay_rules sr
+			  LEFT JOIN rooms rm ON (sr.room_id = rm.id)
+			  WHERE sr.room_id = $1 AND $2 <= sr.end_date AND $3 >= sr.start_date
+			  ORDER BY sr.start_date`
+
+	return m.queryStayRules(ctx, query, roomID, start, end)
+}
+
+func (m *postgresDBRepo) queryStayRules(ctx context.Context, query string, args ...interface{}) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.StayRule
+		var closedToArrival, closedToDeparture string
+		err := rows.Scan(
+			&rule.ID,
+			&rule.RoomID,
+			&rule.StartDate,
+			&rule.EndDate,
+			&rule.MinNights,
+			&rule.MaxNights,
+			&closedToArrival,
+			&closedToDeparture,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+			&rule.Room.ID,
+			&rule.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rule.ClosedToArrival = splitWeekdays(closedToArrival)
+		rule.ClosedToDeparture = splitWeekdays(closedToDeparture)
+
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// InsertStayRule inserts a stay rule into the database
+func (m *postgresDBRepo) InsertStayRule(rule models.StayRule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO stay_rules (room_id, start_date, end_date, min_nights, max_nights,
+			 closed_to_arrival, closed_to_departure, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		rule.RoomID,
+		rule.StartDate,
+		rule.EndDate,
+		rule.MinNights,
+		rule.MaxNights,
+		joinWeekdays(rule.ClosedToArrival),
+		joinWeekdays(rule.ClosedToDeparture),
+		time.Now(),
+		time.Now(),
+	).Scan(&rule.ID)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditStayRuleCreated, models.AuditEntityStayRule, rule.ID, nil, auditedStayRule(rule))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteStayRule deletes a stay rule by id
+func (m *postgresDBRepo) DeleteStayRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM stay_rules WHERE id = $1
+			  RETURNING room_id, start_date, end_date, min_nights, max_nights, closed_to_arrival, closed_to_departure`
+
+	var rule models.StayRule
+	var closedToArrival, closedToDeparture string
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&rule.RoomID,
+		&rule.StartDate,
+		&rule.EndDate,
+		&rule.MinNights,
+		&rule.MaxNights,
+		&closedToArrival,
+		&closedToDeparture,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	rule.ClosedToArrival = splitWeekdays(closedToArrival)
+	rule.ClosedToDeparture = splitWeekdays(closedToDeparture)
+
+	err = m.audit(ctx, tx, models.AuditStayRuleDeleted, models.AuditEntityStayRule, id, auditedStayRule(rule), nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// QueueEmail adds an email to the outbox for the mail worker to deliver
+func (m *postgresDBRepo) QueueEmail(msg models.MailData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queueEmail(ctx, m.DB, msg)
+}
+
+// queueEmail inserts an outbox row, inside a transaction when given one
+func queueEmail(ctx context.Context, db execer, msg models.MailData) error {
+	attachments, err := json.Marshal(msg.Attachments)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO email_outbox (to_address, from_address, subject, content, plain_text,
+			attachments, status, next_attempt_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err = db.ExecContext(ctx, stmt,
+		msg.To,
+		msg.From,
+		msg.Subject,
+		msg.Content,
+		msg.PlainText,
+		string(attachments),
+		models.EmailPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
+}
+
+// ClaimDueEmails returns up to limit pending emails that are due, pushing their next attempt back by
+// lease so that another worker does not pick them up while they are being sent
+func (m *postgresDBRepo) ClaimDueEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE email_outbox SET next_attempt_at = $1, updated_at = $2
+			WHERE id IN (
+				SELECT id FROM email_outbox
+				WHERE status = $3 AND next_attempt_at <= $2
+				ORDER BY next_attempt_at
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + outboxColumns
+
+	now := time.Now()
+
+	return m.queryOutbox(ctx, query, now.Add(lease), now, models.EmailPending, limit)
+}
+
+// MarkEmailSent records the successful delivery of an outbox email
+func (m *postgresDBRepo) MarkEmailSent(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE email_outbox SET status = $1, attempts = attempts + 1, last_error = '',
+			sent_at = $2, updated_at = $2 WHERE id = $3`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.EmailSent, time.Now(), id)
+
+	return err
+}
+
+// MarkEmailFailed records a failed delivery attempt. The email is retried at nextAttempt, or moved to
+// the failed status when dead is set.
+func (m *postgresDBRepo) MarkEmailFailed(id int, lastError string, nextAttempt time.Time, dead bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	status := models.EmailPending
+	if dead {
+		status = models.EmailFailed
+	}
+
+	stmt := `UPDATE email_outbox SET status = $1, attempts = attempts + 1, last_error = $2,
+			next_attempt_at = $3, updated_at = $4 WHERE id = $5`
+
+	_, err := m.DB.ExecContext(ctx, stmt, status, lastError, nextAttempt, time.Now(), id)
+
+	return err
+}
+
+// FailedEmails returns the emails that gave up after too many attempts, newest first
+func (m *postgresDBRepo) FailedEmails() ([]models.OutboxEmail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + outboxColumns + ` FROM email_outbox WHERE status = $1 ORDER BY updated_at DESC`
+
+	return m.queryOutbox(ctx, query, models.EmailFailed)
+}
+
+// ResendEmail puts a failed email back in the queue with a fresh set of attempts
+func (m *postgresDBRepo) ResendEmail(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE email_outbox SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+			WHERE id = $3 AND status = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.EmailPending, time.Now(), id, models.EmailFailed)
+
+	return err
+}
+
+func (m *postgresDBRepo) queryOutbox(ctx context.Context, query string, args ...interface{}) ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return emails, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			return emails, err
+		}
+		emails = append(emails, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return emails, err
+	}
+
+	return emails, nil
+}
+
+// AllICalFeeds returns all external calendar feeds with their room
+func (m *postgresDBRepo) AllICalFeeds() ([]models.ICalFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var feeds []models.ICalFeed
+
+	query := `SELECT ` + icalFeedColumns + `
+			  FROM ical_feeds f
+			  LEFT JOIN rooms rm ON (f.room_id = rm.id)
+			  ORDER BY rm.room_name, f.name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return feeds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		feed, err := scanICalFeed(rows)
+		if err != nil {
+			return feeds, err
+		}
+		feeds = append(feeds, feed)
+	}
+
+	if err = rows.Err(); err != nil {
+		return feeds, err
+	}
+
+	return feeds, nil
+}
+
+// GetICalFeedByID returns an external calendar feed by id
+func (m *postgresDBRepo) GetICalFeedByID(id int) (models.ICalFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + icalFeedColumns + `
+			  FROM ical_feeds f
+			  LEFT JOIN rooms rm ON (f.room_id = rm.id)
+			  WHERE f.id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	return scanICalFeed(row)
+}
+
+// InsertICalFeed adds an external calendar feed to a room and returns its id
+func (m *postgresDBRepo) InsertICalFeed(feed models.ICalFeed) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO ical_feeds (room_id, name, url, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, feed.RoomID, feed.Name, feed.URL, time.Now(), time.Now()).Scan(&feed.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.audit(ctx, tx, models.AuditICalFeedCreated, models.AuditEntityICalFeed, feed.ID, nil, auditedICalFeed(feed))
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return feed.ID, nil
+}
+
+// DeleteICalFeed deletes an external calendar feed together with the restrictions imported from it
+func (m *postgresDBRepo) DeleteICalFeed(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var feed models.ICalFeed
+	err = tx.QueryRowContext(ctx, `DELETE FROM ical_feeds WHERE id = $1 RETURNING room_id, name`, id).
+		Scan(&feed.RoomID, &feed.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditICalFeedDeleted, models.AuditEntityICalFeed, id, auditedICalFeed(feed), nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateICalFeedStatus records the outcome of the last sync of a feed
+func (m *postgresDBRepo) UpdateICalFeedStatus(feed models.ICalFeed) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE ical_feeds SET last_synced_at = $2, last_status = $3, last_error = $4, event_count = $5,
+			 updated_at = $6 WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		feed.ID,
+		feed.LastSyncedAt,
+		feed.LastStatus,
+		feed.LastError,
+		feed.EventCount,
+		time.Now(),
+	)
+
+	return err
+}
+
+// GetExternalRestrictions returns the restrictions imported from a feed
+func (m *postgresDBRepo) GetExternalRestrictions(feedID int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `SELECT id, room_id, restriction_id, start_date, end_date, ical_feed_id, external_uid
+			  FROM room_restrictions WHERE ical_feed_id = $1`
+
+	rows, err := m.DB.QueryContext(ctx, query, feedID)
+	if err != nil {
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.RoomID,
+			&r.RestrictionID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.ICalFeedID,
+			&r.ExternalUID,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// InsertExternalRestriction inserts a restriction imported from a feed. ErrRoomNotAvailable is
+// returned when it overlaps another restriction of the room.
+func (m *postgresDBRepo) InsertExternalRestriction(r models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id,
+			 ical_feed_id, external_uid, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		r.RestrictionID,
+		r.ICalFeedID,
+		r.ExternalUID,
+		time.Now(),
+		time.Now(),
+	)
+
+	return overlapError(err)
+}
+
+// UpdateExternalRestriction moves an imported restriction to new dates. ErrRoomNotAvailable is
+// returned when they overlap another restriction of the room.
+func (m *postgresDBRepo) UpdateExternalRestriction(r models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE room_restrictions SET start_date = $2, end_date = $3, updated_at = $4
+			 WHERE id = $1 AND ical_feed_id IS NOT NULL`
+
+	_, err := m.DB.ExecContext(ctx, stmt, r.ID, r.StartDate, r.EndDate, time.Now())
+
+	return overlapError(err)
+}
+
+// APITokensForUser returns the API tokens of a user, newest first
+func (m *postgresDBRepo) APITokensForUser(userID int) ([]models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tokens []models.APIToken
+
+	query := `SELECT ` + apiTokenColumns + `
+			  FROM api_tokens t
+			  LEFT JOIN users u ON (t.user_id = u.id)
+			  WHERE t.user_id = $1
+			  ORDER BY t.created_at DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenByHash gets the API token with a hash, together with its user
+func (m *postgresDBRepo) GetAPITokenByHash(hash string) (models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + apiTokenColumns + `
+			  FROM api_tokens t
+			  JOIN users u ON (t.user_id = u.id)
+			  WHERE t.token_hash = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, hash)
+	return scanAPIToken(row)
+}
+
+// InsertAPIToken inserts an API token and returns its id
+func (m *postgresDBRepo) InsertAPIToken(token models.APIToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `INSERT INTO api_tokens (user_id, name, display, token_hash, scope, expires_at, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		token.UserID,
+		token.Name,
+		token.Display,
+		token.TokenHash,
+		token.Scope,
+		token.ExpiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteAPIToken deletes one of a user's API tokens
+func (m *postgresDBRepo) DeleteAPIToken(id, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+
+	return err
+}
+
+// MarkAPITokenUsed records when an API token was last used
+func (m *postgresDBRepo) MarkAPITokenUsed(id int, usedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+
+	return err
+}
+
+// AllWebhooks returns all webhooks
+func (m *postgresDBRepo) AllWebhooks() ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hooks []models.Webhook
+
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY url`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return hooks, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+// GetWebhookByID gets a webhook by id
+func (m *postgresDBRepo) GetWebhookByID(id int) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getWebhook(ctx, m.DB, id)
+}
+
+// getWebhook reads a webhook by id through db, which may be a transaction
+func getWebhook(ctx context.Context, db queryRower, id int) (models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	row := db.QueryRowContext(ctx, query, id)
+	return scanWebhook(row)
+}
+
+// InsertWebhook inserts a webhook and returns its id
+func (m *postgresDBRepo) InsertWebhook(hook models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO webhooks (url, secret, events, active, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		hook.URL,
+		hook.Secret,
+		joinEvents(hook.Events),
+		hook.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&hook.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.audit(ctx, tx, models.AuditWebhookCreated, models.AuditEntityWebhook, hook.ID, nil, auditedWebhook(hook))
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return hook.ID, nil
+}
+
+// UpdateWebhook updates a webhook
+func (m *postgresDBRepo) UpdateWebhook(hook models.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getWebhook(ctx, tx, hook.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE webhooks SET url = $2, secret = $3, events = $4, active = $5, updated_at = $6
+			 WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		hook.ID,
+		hook.URL,
+		hook.Secret,
+		joinEvents(hook.Events),
+		hook.Active,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditWebhookUpdated, models.AuditEntityWebhook, hook.ID,
+		auditedWebhook(before), auditedWebhook(hook))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries
+func (m *postgresDBRepo) DeleteWebhook(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hook, err := scanWebhook(tx.QueryRowContext(ctx, `DELETE FROM webhooks WHERE id = $1 RETURNING `+webhookColumns, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = m.audit(ctx, tx, models.AuditWebhookDeleted, models.AuditEntityWebhook, id, auditedWebhook(hook), nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// queueWebhookMessage inserts a delivery of msg for every active webhook subscribing to its event,
+// inside the transaction of the change that caused it
+func queueWebhookMessage(ctx context.Context, db execer, msg models.WebhookMessage) error {
+	stmt := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+			 SELECT id, $1, $2, $3, $4, $4, $4 FROM webhooks
+			 WHERE active AND $1 = ANY(string_to_array(events, ','))`
+
+	_, err := db.ExecContext(ctx, stmt, msg.Event, string(msg.Payload), models.EmailPending, time.Now())
+
+	return err
+}
+
+// ClaimDueWebhookDeliveries returns up to limit deliveries that are due, hiding them from other
+// workers for the lease duration
+func (m *postgresDBRepo) ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries d SET next_attempt_at = $1, updated_at = $2
+			FROM webhooks w
+			WHERE d.webhook_id = w.id AND d.id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = $3 AND next_attempt_at <= $2
+				ORDER BY next_attempt_at
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + webhookDeliveryColumns
+
+	now := time.Now()
+
+	return m.queryWebhookDeliveries(ctx, query, now.Add(lease), now, models.EmailPending, limit)
+}
+
+// MarkWebhookDelivered records a successful delivery
+func (m *postgresDBRepo) MarkWebhookDelivered(id, responseStatus int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_status = $2,
+			last_error = '', delivered_at = $3, updated_at = $3 WHERE id = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.EmailSent, responseStatus, time.Now(), id)
+
+	return err
+}
+
+// MarkWebhookFailed records a failed attempt. The delivery is retried at nextAttempt, or given up if dead.
+func (m *postgresDBRepo) MarkWebhookFailed(id, responseStatus int, lastError string, nextAttempt time.Time, dead bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	status := models.EmailPending
+	if dead {
+		status = models.EmailFailed
+	}
+
+	stmt := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_status = $2,
+			last_error = $3, next_attempt_at = $4, updated_at = $5 WHERE id = $6`
+
+	_, err := m.DB.ExecContext(ctx, stmt, status, responseStatus, lastError, nextAttempt, time.Now(), id)
+
+	return err
+}
+
+// WebhookDeliveries returns the latest deliveries of a webhook, newest first
+func (m *postgresDBRepo) WebhookDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + `
+			  FROM webhook_deliveries d
+			  JOIN webhooks w ON (d.webhook_id = w.id)
+			  WHERE d.webhook_id = $1
+			  ORDER BY d.created_at DESC, d.id DESC
+			  LIMIT $2`
+
+	return m.queryWebhookDeliveries(ctx, query, webhookID, limit)
+}
+
+// RetryWebhookDelivery queues a failed delivery again with a fresh set of attempts
+func (m *postgresDBRepo) RetryWebhookDelivery(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+			WHERE id = $3 AND status = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, models.EmailPending, time.Now(), id, models.EmailFailed)
+
+	return err
+}
+
+// queryWebhookDeliveries runs a query returning webhookDeliveryColumns
+func (m *postgresDBRepo) queryWebhookDeliveries(ctx context.Context, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// insertAuditEvent adds an event to the audit log, inside the transaction of the change it records
+func insertAuditEvent(ctx context.Context, db execer, e models.AuditEvent) error {
+	// a side without fields, like before for something new, is stored as null
+	var before, after interface{}
+	if e.Before != "" {
+		before = e.Before
+	}
+	if e.After != "" {
+		after = e.After
+	}
+
+	stmt := `INSERT INTO audit_events (user_id, action, entity, entity_id, before, after, ip_address, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := db.ExecContext(ctx, stmt,
+		e.UserID,
+		e.Action,
+		e.Entity,
+		e.EntityID,
+		before,
+		after,
+		e.IPAddress,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AuditEvents returns the latest audit events matching a filter, newest first, with their users
+func (m *postgresDBRepo) AuditEvents(filter models.AuditFilter, limit int) ([]models.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var events []models.AuditEvent
+
+	var where []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID > 0 {
+		add("e.user_id = $%d", filter.UserID)
+	}
+	if filter.Action != "" {
+		add("e.action = $%d", filter.Action)
+	}
+	if filter.Entity != "" {
+		add("e.entity = $%d", filter.Entity)
+	}
+	if filter.EntityID > 0 {
+		add("e.entity_id = $%d", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		add("e.created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("e.created_at < $%d", filter.To)
+	}
+
+	query := `SELECT e.id, e.user_id, e.action, e.entity, e.entity_id, e.before, e.after, e.ip_address,
+			  e.created_at, e.updated_at, u.first_name, u.last_name, u.email
+			  FROM audit_events e
+			  JOIN users u ON (u.id = e.user_id)`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY e.created_at DESC, e.id DESC LIMIT $%d`, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEvent
+		var before, after sql.NullString
+		err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&before,
+			&after,
+			&e.IPAddress,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+			&e.User.FirstName,
+			&e.User.LastName,
+			&e.User.Email,
+		)
+		if err != nil {
+			return events, err
+		}
+		e.Before = before.String
+		e.After = after.String
+		e.User.ID = e.UserID
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return events, err
+	}
+
+	return events, nil
+}
@@ -1,11 +1,14 @@
 package dbrepo
 
 import (
+	"bookings/internal/apitoken"
 	"bookings/internal/config"
 	"bookings/internal/models"
+	"bookings/internal/permission"
 	"bookings/internal/repository"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -20,8 +23,15 @@ func NewTestingsRepo(a *config.AppConfig) repository.DatabaseRepo {
 	}
 }
 
-func (m *testDBRepo) AllUsers() bool {
-	return true
+// AllUsers returns all users
+func (m *testDBRepo) AllUsers() ([]models.User, error) {
+	var users []models.User
+	for id := 1; id <= 2; id++ {
+		user, _ := m.GetUserByID(id)
+		users = append(users, user)
+	}
+
+	return users, nil
 }
 
 // InsertReservation inserts a reservation into the database
@@ -34,14 +44,38 @@ func (m *testDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
 	return nil
 }
 
+// CreateBooking inserts a reservation and its room restriction in one transaction
+func (m *testDBRepo) CreateBooking(res models.Reservation, confirmation func(id int) (models.MailData, error), publish func(res models.Reservation) (models.WebhookMessage, error)) (int, error) {
+	if !res.StartDate.Before(testBookedFrom) {
+		return 0, repository.ErrRoomNotAvailable
+	}
+	return 1, nil
+}
+
+// testBookedFrom is the date from which every room is booked, and testFailingDate the start date
+// for which availability searches fail
+var (
+	testBookedFrom  = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	testFailingDate = time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
 func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	return false, nil
+	if start.Equal(testFailingDate) {
+		return false, errors.New("cannot search availability")
+	}
+	return start.Before(testBookedFrom), nil
 }
 
 // SearchAvailabilityForAllRooms returns a slice of availabile rooms, if any, for given date range
 func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
 	var rooms []models.Room
+	if start.Equal(testFailingDate) {
+		return rooms, errors.New("cannot search availability")
+	}
+	if start.Before(testBookedFrom) {
+		rooms = append(rooms, models.Room{ID: 1, RoomName: "General's Quarters"})
+	}
 	return rooms, nil
 }
 
@@ -54,10 +88,33 @@ func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
 	return room, nil
 }
 
-// GetUserByID returns a user by ID
+// GetRoomBySlug gets a room by its URL slug
+func (m *testDBRepo) GetRoomBySlug(slug string) (models.Room, error) {
+	var room models.Room
+	if slug != "generals-quarters" && slug != "majors-suite" {
+		return room, sql.ErrNoRows
+	}
+	room.Slug = slug
+	return room, nil
+}
+
+// GetUserByID returns a user by ID, user 1 is the only owner and user 2 works at the front desk
 func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
 	var user models.User
+	if id > 2 {
+		return user, sql.ErrNoRows
+	}
 
+	user.ID = id
+	user.FirstName = "Test"
+	user.LastName = "User"
+	user.Email = fmt.Sprintf("user%d@here.ca", id)
+	user.Password = "hashed"
+	user.Active = true
+	user.AccessLevel = permission.RoleFrontDesk
+	if id == 1 {
+		user.AccessLevel = permission.RoleOwner
+	}
 	return user, nil
 }
 
@@ -66,8 +123,187 @@ func (m *testDBRepo) UpdateUser(u models.User) error {
 	return nil
 }
 
+// InsertUser inserts a user
+func (m *testDBRepo) InsertUser(u models.User) (int, error) {
+	return 1, nil
+}
+
+// GetUserByEmail returns a user by email address
+func (m *testDBRepo) GetUserByEmail(email string) (models.User, error) {
+	return models.User{}, sql.ErrNoRows
+}
+
+// InsertUserToken inserts a one-time token
+func (m *testDBRepo) InsertUserToken(t models.UserToken) (int, error) {
+	return 1, nil
+}
+
+// GetUserTokenByHash gets an unused and unexpired token
+func (m *testDBRepo) GetUserTokenByHash(purpose, hash string) (models.UserToken, error) {
+	if hash == "" {
+		return models.UserToken{}, sql.ErrNoRows
+	}
+	return models.UserToken{ID: 1, UserID: 1, Purpose: purpose, TokenHash: hash}, nil
+}
+
+// SetPasswordWithToken uses up a one-time token and sets the password of its user
+func (m *testDBRepo) SetPasswordWithToken(purpose, hash, password string) (int, error) {
+	if hash == "" {
+		return 0, repository.ErrInvalidUserToken
+	}
+	return 1, nil
+}
+
+// EnableTOTP turns on two-factor authentication for a user
+func (m *testDBRepo) EnableTOTP(userID int, secret string, step int64, codeHashes []string) error {
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication for a user
+func (m *testDBRepo) DisableTOTP(userID int) error {
+	return nil
+}
+
+// UseTOTPStep records the time step of a two-factor code a user logged in with
+func (m *testDBRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user
+func (m *testDBRepo) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	return nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes a user has
+func (m *testDBRepo) RecoveryCodesLeft(userID int) (int, error) {
+	return 0, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used
+func (m *testDBRepo) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	return false, nil
+}
+
+// InsertTrustedDevice inserts a trusted device
+func (m *testDBRepo) InsertTrustedDevice(d models.TrustedDevice) (int, error) {
+	return 1, nil
+}
+
+// IsTrustedDevice reports whether a token hash belongs to a trusted device of the user
+func (m *testDBRepo) IsTrustedDevice(userID int, tokenHash string) (bool, error) {
+	return false, nil
+}
+
+// TrustedDevicesForUser returns the trusted devices of a user
+func (m *testDBRepo) TrustedDevicesForUser(userID int) ([]models.TrustedDevice, error) {
+	var devices []models.TrustedDevice
+
+	return devices, nil
+}
+
+// DeleteTrustedDevices forgets all trusted devices of a user
+func (m *testDBRepo) DeleteTrustedDevices(userID int) error {
+	return nil
+}
+
+// InsertLoginFailure records a failed login attempt
+func (m *testDBRepo) InsertLoginFailure(f models.LoginFailure) error {
+	return nil
+}
+
+// LoginFailureCounts returns the counted failures for an account and an IP address
+func (m *testDBRepo) LoginFailureCounts(email, ip string, since time.Time) (models.LoginCounts, models.LoginCounts, error) {
+	return models.LoginCounts{}, models.LoginCounts{}, nil
+}
+
+// ClearLoginFailures stops the failures of an account from counting
+func (m *testDBRepo) ClearLoginFailures(email string) error {
+	return nil
+}
+
+// LockedAccounts returns the accounts locked out by failed logins
+func (m *testDBRepo) LockedAccounts(since time.Time, threshold int) ([]models.LockedAccount, error) {
+	var accounts []models.LockedAccount
+
+	return accounts, nil
+}
+
+// RecentLoginFailures returns the latest failed login attempts
+func (m *testDBRepo) RecentLoginFailures(limit int) ([]models.LoginFailure, error) {
+	var failures []models.LoginFailure
+
+	return failures, nil
+}
+
+// FindSession returns the data of an unexpired session
+func (m *testDBRepo) FindSession(token string) ([]byte, error) {
+	return nil, sql.ErrNoRows
+}
+
+// CommitSession stores the data of a session
+func (m *testDBRepo) CommitSession(token string, data []byte, expiry time.Time) error {
+	return nil
+}
+
+// DeleteSession removes a session
+func (m *testDBRepo) DeleteSession(token string) error {
+	return nil
+}
+
+// DeleteExpiredSessions removes the expired sessions
+func (m *testDBRepo) DeleteExpiredSessions() (int, error) {
+	return 0, nil
+}
+
+// DeleteUserSessionsStartedBefore removes the user sessions started before t
+func (m *testDBRepo) DeleteUserSessionsStartedBefore(t time.Time) (int, error) {
+	return 0, nil
+}
+
+// InsertUserSession records a browser where a user logged in
+func (m *testDBRepo) InsertUserSession(s models.UserSession) error {
+	return nil
+}
+
+// GetUserSessionByToken returns the user session of a session token
+func (m *testDBRepo) GetUserSessionByToken(token string) (models.UserSession, error) {
+	return models.UserSession{}, sql.ErrNoRows
+}
+
+// TouchUserSession records that a session was used
+func (m *testDBRepo) TouchUserSession(id int, ip string, seenAt time.Time) error {
+	return nil
+}
+
+// UserSessionsForUser returns the sessions of a user
+func (m *testDBRepo) UserSessionsForUser(userID int, since time.Time) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+
+	return sessions, nil
+}
+
+// DeleteUserSession removes a session of a user and returns its token
+func (m *testDBRepo) DeleteUserSession(id, userID int) (string, error) {
+	return "", sql.ErrNoRows
+}
+
+// DeleteUserSessionByToken removes the user session of a session token
+func (m *testDBRepo) DeleteUserSessionByToken(token string) error {
+	return nil
+}
+
+// DeleteUserSessionsForUser removes all sessions of a user and returns their tokens
+func (m *testDBRepo) DeleteUserSessionsForUser(userID int) ([]string, error) {
+	var tokens []string
+
+	return tokens, nil
+}
+
 // Authenticate authenticates a user
 func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+	if email != "me@here.ca" {
+		return 0, "", errors.New("incorrect password")
+	}
 	return 1, "", nil
 }
 
@@ -85,25 +321,56 @@ func (m *testDBRepo) NewReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
+// CancelReservation cancels a reservation and records the fee the guest owes for it
+func (m *testDBRepo) CancelReservation(id, fee int, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	return nil
+}
+
+// ChangeReservationDates moves a reservation and its room restriction to new dates and price
+func (m *testDBRepo) ChangeReservationDates(res models.Reservation, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	if res.RoomID > 2 {
+		return repository.ErrRoomNotAvailable
+	}
+	return nil
+}
+
+// ReservationsByStatus returns a slice of the reservations in a status
+func (m *testDBRepo) ReservationsByStatus(status string) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	return reservations, nil
+}
+
 // GetReservationByID returns the reservation extracted by id
 func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
 	var reservation models.Reservation
+	if id > 2 {
+		return reservation, sql.ErrNoRows
+	}
 
+	reservation.ID = id
+	reservation.RoomID = 1
+	reservation.Status = models.StatusPending
+	reservation.StartDate = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	reservation.EndDate = time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC)
 	return reservation, nil
 }
 
 // UpdateReservation updates a reservation in the database
-func (m *testDBRepo) UpdateReservation(r models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(r models.Reservation, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
 	return nil
 }
 
 // DeleteReservation deletes one reservation by id
-func (m *testDBRepo) DeleteReservation(id int) error {
+func (m *testDBRepo) DeleteReservation(id int, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
 	return nil
 }
 
-// UpdateProcessedForReservation updates processed for a reservation by id
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// UpdateReservationStatus moves a reservation to a new status and records when it happened
+func (m *testDBRepo) UpdateReservationStatus(id int, status string, publish func(res models.Reservation) (models.WebhookMessage, error)) error {
+	if !models.CanTransition(models.StatusPending, status) {
+		return repository.ErrInvalidStatusTransition
+	}
 	return nil
 }
 
@@ -121,8 +388,31 @@ func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Ti
 	return restrictions, nil
 }
 
+// GetRestrictionsForRoom returns every restriction of a room
+func (m *testDBRepo) GetRestrictionsForRoom(roomID int) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	return restrictions, nil
+}
+
+// GetRoomICalToken returns the secret token of a room's calendar feed
+func (m *testDBRepo) GetRoomICalToken(roomID int) (string, error) {
+	if roomID > 2 {
+		return "", sql.ErrNoRows
+	}
+	return "secret", nil
+}
+
+// UpdateRoomICalToken replaces the secret token of a room's calendar feed
+func (m *testDBRepo) UpdateRoomICalToken(roomID int, token string) error {
+	return nil
+}
+
 // InsertBlockForRoom inserts a block restriction for a room by id and date
 func (m *testDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) error {
+	if !startDate.Before(testBookedFrom) {
+		return repository.ErrRoomNotAvailable
+	}
 	return nil
 }
 
@@ -130,3 +420,276 @@ func (m *testDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) error {
 func (m *testDBRepo) DeleteRoomRestrictionByID(id int) error {
 	return nil
 }
+
+// InsertRoom inserts a room into the database
+func (m *testDBRepo) InsertRoom(room models.Room) (int, error) {
+	return 1, nil
+}
+
+// UpdateRoom updates a room in the database
+func (m *testDBRepo) UpdateRoom(room models.Room) error {
+	return nil
+}
+
+// DeleteRoom deletes a room by id, unless it has any reservations or blocks ending today or later
+func (m *testDBRepo) DeleteRoom(id int) error {
+	if id > 2 {
+		return repository.ErrRoomInUse
+	}
+	return nil
+}
+
+// GetSeasonalRatesForRoom returns all seasonal rates of a room
+func (m *testDBRepo) GetSeasonalRatesForRoom(roomID int) ([]models.SeasonalRate, error) {
+	var seasons []models.SeasonalRate
+
+	return seasons, nil
+}
+
+// GetSeasonalRatesForRoomByDate returns the seasonal rates of a room overlapping a stay from start to end
+func (m *testDBRepo) GetSeasonalRatesForRoomByDate(roomID int, start, end time.Time) ([]models.SeasonalRate, error) {
+	var seasons []models.SeasonalRate
+
+	return seasons, nil
+}
+
+// InsertSeasonalRate inserts a seasonal rate into the database
+func (m *testDBRepo) InsertSeasonalRate(s models.SeasonalRate) error {
+	return nil
+}
+
+// DeleteSeasonalRate deletes a seasonal rate by id, as long as it belongs to the room
+func (m *testDBRepo) DeleteSeasonalRate(roomID, id int) error {
+	return nil
+}
+
+// AllStayRules returns all stay rules
+func (m *testDBRepo) AllStayRules() ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	return rules, nil
+}
+
+// GetStayRulesForRoomByDate returns the stay rules of a room overlapping the dates from start to end
+func (m *testDBRepo) GetStayRulesForRoomByDate(roomID int, start, end time.Time) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	return rules, nil
+}
+
+// InsertStayRule inserts a stay rule into the database
+func (m *testDBRepo) InsertStayRule(rule models.StayRule) error {
+	return nil
+}
+
+// DeleteStayRule deletes a stay rule by id
+func (m *testDBRepo) DeleteStayRule(id int) error {
+	return nil
+}
+
+// QueueEmail adds an email to the outbox for the mail worker to deliver
+func (m *testDBRepo) QueueEmail(msg models.MailData) error {
+	return nil
+}
+
+// ClaimDueEmails returns up to limit pending emails that are due
+func (m *testDBRepo) ClaimDueEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+
+	return emails, nil
+}
+
+// MarkEmailSent records the successful delivery of an outbox email
+func (m *testDBRepo) MarkEmailSent(id int) error {
+	return nil
+}
+
+// MarkEmailFailed records a failed delivery attempt
+func (m *testDBRepo) MarkEmailFailed(id int, lastError string, nextAttempt time.Time, dead bool) error {
+	return nil
+}
+
+// FailedEmails returns the emails that gave up after too many attempts
+func (m *testDBRepo) FailedEmails() ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+
+	return emails, nil
+}
+
+// ResendEmail puts a failed email back in the queue
+func (m *testDBRepo) ResendEmail(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// AllICalFeeds returns all external calendar feeds
+func (m *testDBRepo) AllICalFeeds() ([]models.ICalFeed, error) {
+	var feeds []models.ICalFeed
+
+	return feeds, nil
+}
+
+// GetICalFeedByID returns an external calendar feed by id
+func (m *testDBRepo) GetICalFeedByID(id int) (models.ICalFeed, error) {
+	if id > 2 {
+		return models.ICalFeed{}, sql.ErrNoRows
+	}
+	return models.ICalFeed{ID: id, RoomID: 1}, nil
+}
+
+// InsertICalFeed adds an external calendar feed to a room
+func (m *testDBRepo) InsertICalFeed(feed models.ICalFeed) (int, error) {
+	return 1, nil
+}
+
+// DeleteICalFeed deletes an external calendar feed
+func (m *testDBRepo) DeleteICalFeed(id int) error {
+	return nil
+}
+
+// UpdateICalFeedStatus records the outcome of the last sync of a feed
+func (m *testDBRepo) UpdateICalFeedStatus(feed models.ICalFeed) error {
+	return nil
+}
+
+// GetExternalRestrictions returns the restrictions imported from a feed
+func (m *testDBRepo) GetExternalRestrictions(feedID int) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	return restrictions, nil
+}
+
+// InsertExternalRestriction inserts a restriction imported from a feed
+func (m *testDBRepo) InsertExternalRestriction(r models.RoomRestriction) error {
+	if r.RoomID > 2 {
+		return repository.ErrRoomNotAvailable
+	}
+	return nil
+}
+
+// UpdateExternalRestriction moves an imported restriction to new dates
+func (m *testDBRepo) UpdateExternalRestriction(r models.RoomRestriction) error {
+	return nil
+}
+
+// APITokensForUser returns the API tokens of a user
+func (m *testDBRepo) APITokensForUser(userID int) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+
+	return tokens, nil
+}
+
+// GetAPITokenByHash gets the API token with a hash
+func (m *testDBRepo) GetAPITokenByHash(hash string) (models.APIToken, error) {
+	token := models.APIToken{
+		ID:        1,
+		UserID:    1,
+		ExpiresAt: time.Now().Add(time.Hour),
+		User:      models.User{ID: 1, Active: true, AccessLevel: permission.RoleFrontDesk},
+	}
+
+	switch hash {
+	case apitoken.Hash(apitoken.Prefix + "read"):
+		token.Scope = models.ScopeRead
+	case apitoken.Hash(apitoken.Prefix + "write"):
+		token.Scope = models.ScopeWrite
+	case apitoken.Hash(apitoken.Prefix + "read-only-user"):
+		token.Scope = models.ScopeWrite
+		token.User.AccessLevel = permission.RoleReadOnly
+	case apitoken.Hash(apitoken.Prefix + "expired"):
+		token.Scope = models.ScopeWrite
+		token.ExpiresAt = time.Now().Add(-time.Hour)
+	default:
+		return models.APIToken{}, sql.ErrNoRows
+	}
+
+	return token, nil
+}
+
+// InsertAPIToken inserts an API token
+func (m *testDBRepo) InsertAPIToken(token models.APIToken) (int, error) {
+	return 1, nil
+}
+
+// DeleteAPIToken deletes one of a user's API tokens
+func (m *testDBRepo) DeleteAPIToken(id, userID int) error {
+	return nil
+}
+
+// MarkAPITokenUsed records when an API token was last used
+func (m *testDBRepo) MarkAPITokenUsed(id int, usedAt time.Time) error {
+	return nil
+}
+
+// AllWebhooks returns all webhooks
+func (m *testDBRepo) AllWebhooks() ([]models.Webhook, error) {
+	var hooks []models.Webhook
+
+	return hooks, nil
+}
+
+// GetWebhookByID gets a webhook by id
+func (m *testDBRepo) GetWebhookByID(id int) (models.Webhook, error) {
+	if id > 2 {
+		return models.Webhook{}, sql.ErrNoRows
+	}
+	return models.Webhook{ID: id, Active: true}, nil
+}
+
+// InsertWebhook inserts a webhook
+func (m *testDBRepo) InsertWebhook(hook models.Webhook) (int, error) {
+	return 1, nil
+}
+
+// UpdateWebhook updates a webhook
+func (m *testDBRepo) UpdateWebhook(hook models.Webhook) error {
+	return nil
+}
+
+// DeleteWebhook deletes a webhook
+func (m *testDBRepo) DeleteWebhook(id int) error {
+	return nil
+}
+
+// ClaimDueWebhookDeliveries returns the deliveries that are due
+func (m *testDBRepo) ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records a successful delivery
+func (m *testDBRepo) MarkWebhookDelivered(id, responseStatus int) error {
+	return nil
+}
+
+// MarkWebhookFailed records a failed delivery attempt
+func (m *testDBRepo) MarkWebhookFailed(id, responseStatus int, lastError string, nextAttempt time.Time, dead bool) error {
+	return nil
+}
+
+// WebhookDeliveries returns the latest deliveries of a webhook
+func (m *testDBRepo) WebhookDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery queues a failed delivery again
+func (m *testDBRepo) RetryWebhookDelivery(id int) error {
+	return nil
+}
+
+// WithActor returns a repository recording the changes actor makes through it in the audit log
+func (m *testDBRepo) WithActor(actor models.AuditActor) repository.DatabaseRepo {
+	return m
+}
+
+// AuditEvents returns the latest audit events matching a filter
+func (m *testDBRepo) AuditEvents(filter models.AuditFilter, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+
+	return events, nil
+}
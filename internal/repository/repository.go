@@ -2,26 +2,122 @@ package repository
 
 import (
 	"bookings/internal/models"
+	"errors"
 	"time"
 )
 
+// ErrRoomInUse is returned when deleting a room that has reservations, past or upcoming, or upcoming blocks
+var ErrRoomInUse = errors.New("room has reservations or upcoming blocks")
+
+// ErrRoomNotAvailable is returned when a booking overlaps a reservation or block of the room
+var ErrRoomNotAvailable = errors.New("room is not available for these dates")
+
+// ErrInvalidUserToken is returned when a one-time link has already been used or has expired
+var ErrInvalidUserToken = errors.New("invalid or expired link")
+
+// ErrInvalidStatusTransition is returned when a reservation cannot move from its status to the requested one
+var ErrInvalidStatusTransition = errors.New("invalid reservation status transition")
+
 type DatabaseRepo interface {
-	AllUsers() bool
+	AllUsers() ([]models.User, error)
 	InsertReservation(res models.Reservation) (int, error)
 	InsertRoomRestriction(res models.RoomRestriction) error
+	CreateBooking(res models.Reservation, confirmation func(id int) (models.MailData, error), publish func(res models.Reservation) (models.WebhookMessage, error)) (int, error)
 	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
 	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
 	GetRoomByID(id int) (models.Room, error)
+	GetRoomBySlug(slug string) (models.Room, error)
 	GetUserByID(id int) (models.User, error)
+	GetUserByEmail(email string) (models.User, error)
+	InsertUser(u models.User) (int, error)
+	UpdateUser(u models.User) error
+	InsertUserToken(t models.UserToken) (int, error)
+	GetUserTokenByHash(purpose, hash string) (models.UserToken, error)
+	SetPasswordWithToken(purpose, hash, password string) (int, error)
+	EnableTOTP(userID int, secret string, step int64, codeHashes []string) error
+	DisableTOTP(userID int) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	RecoveryCodesLeft(userID int) (int, error)
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	InsertTrustedDevice(d models.TrustedDevice) (int, error)
+	IsTrustedDevice(userID int, tokenHash string) (bool, error)
+	TrustedDevicesForUser(userID int) ([]models.TrustedDevice, error)
+	DeleteTrustedDevices(userID int) error
+	InsertLoginFailure(f models.LoginFailure) error
+	LoginFailureCounts(email, ip string, since time.Time) (models.LoginCounts, models.LoginCounts, error)
+	ClearLoginFailures(email string) error
+	LockedAccounts(since time.Time, threshold int) ([]models.LockedAccount, error)
+	RecentLoginFailures(limit int) ([]models.LoginFailure, error)
+	FindSession(token string) ([]byte, error)
+	CommitSession(token string, data []byte, expiry time.Time) error
+	DeleteSession(token string) error
+	DeleteExpiredSessions() (int, error)
+	DeleteUserSessionsStartedBefore(t time.Time) (int, error)
+	InsertUserSession(s models.UserSession) error
+	GetUserSessionByToken(token string) (models.UserSession, error)
+	TouchUserSession(id int, ip string, seenAt time.Time) error
+	UserSessionsForUser(userID int, since time.Time) ([]models.UserSession, error)
+	DeleteUserSession(id, userID int) (string, error)
+	DeleteUserSessionByToken(token string) error
+	DeleteUserSessionsForUser(userID int) ([]string, error)
 	Authenticate(email, testPassword string) (int, string, error)
 	AllReservations() ([]models.Reservation, error)
 	NewReservations() ([]models.Reservation, error)
+	ReservationsByStatus(status string) ([]models.Reservation, error)
 	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(r models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
+	UpdateReservation(r models.Reservation, publish func(res models.Reservation) (models.WebhookMessage, error)) error
+	DeleteReservation(id int, publish func(res models.Reservation) (models.WebhookMessage, error)) error
+	UpdateReservationStatus(id int, status string, publish func(res models.Reservation) (models.WebhookMessage, error)) error
+	CancelReservation(id, fee int, publish func(res models.Reservation) (models.WebhookMessage, error)) error
+	ChangeReservationDates(res models.Reservation, publish func(res models.Reservation) (models.WebhookMessage, error)) error
 	AllRooms() ([]models.Room, error)
 	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	GetRestrictionsForRoom(roomID int) ([]models.RoomRestriction, error)
+	GetRoomICalToken(roomID int) (string, error)
+	UpdateRoomICalToken(roomID int, token string) error
 	InsertBlockForRoom(roomID int, startDate time.Time) error
 	DeleteRoomRestrictionByID(id int) error
+	InsertRoom(room models.Room) (int, error)
+	UpdateRoom(room models.Room) error
+	DeleteRoom(id int) error
+	GetSeasonalRatesForRoom(roomID int) ([]models.SeasonalRate, error)
+	GetSeasonalRatesForRoomByDate(roomID int, start, end time.Time) ([]models.SeasonalRate, error)
+	InsertSeasonalRate(s models.SeasonalRate) error
+	DeleteSeasonalRate(roomID, id int) error
+	AllStayRules() ([]models.StayRule, error)
+	GetStayRulesForRoomByDate(roomID int, start, end time.Time) ([]models.StayRule, error)
+	InsertStayRule(rule models.StayRule) error
+	DeleteStayRule(id int) error
+	QueueEmail(msg models.MailData) error
+	ClaimDueEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error)
+	MarkEmailSent(id int) error
+	MarkEmailFailed(id int, lastError string, nextAttempt time.Time, dead bool) error
+	FailedEmails() ([]models.OutboxEmail, error)
+	ResendEmail(id int) error
+	AllICalFeeds() ([]models.ICalFeed, error)
+	GetICalFeedByID(id int) (models.ICalFeed, error)
+	InsertICalFeed(feed models.ICalFeed) (int, error)
+	DeleteICalFeed(id int) error
+	UpdateICalFeedStatus(feed models.ICalFeed) error
+	GetExternalRestrictions(feedID int) ([]models.RoomRestriction, error)
+	InsertExternalRestriction(r models.RoomRestriction) error
+	UpdateExternalRestriction(r models.RoomRestriction) error
+	APITokensForUser(userID int) ([]models.APIToken, error)
+	GetAPITokenByHash(hash string) (models.APIToken, error)
+	InsertAPIToken(token models.APIToken) (int, error)
+	DeleteAPIToken(id, userID int) error
+	MarkAPITokenUsed(id int, usedAt time.Time) error
+	AllWebhooks() ([]models.Webhook, error)
+	GetWebhookByID(id int) (models.Webhook, error)
+	InsertWebhook(hook models.Webhook) (int, error)
+	UpdateWebhook(hook models.Webhook) error
+	DeleteWebhook(id int) error
+	ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	MarkWebhookDelivered(id, responseStatus int) error
+	MarkWebhookFailed(id, responseStatus int, lastError string, nextAttempt time.Time, dead bool) error
+	WebhookDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error)
+	RetryWebhookDelivery(id int) error
+	WithActor(actor models.AuditActor) DatabaseRepo
+	AuditEvents(filter models.AuditFilter, limit int) ([]models.AuditEvent, error)
 }
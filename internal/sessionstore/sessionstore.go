@@ -0,0 +1,107 @@
+package sessionstore
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Kinds of session stores the application can use
+const (
+	KindMemory   = "memory"
+	KindPostgres = "postgres"
+)
+
+// Store is the part of the database repository used by the session store
+type Store interface {
+	FindSession(token string) ([]byte, error)
+	CommitSession(token string, data []byte, expiry time.Time) error
+	DeleteSession(token string) error
+	DeleteExpiredSessions() (int, error)
+}
+
+// UserSessionStore is the part of the database repository used to clean up the user sessions
+type UserSessionStore interface {
+	DeleteUserSessionsStartedBefore(t time.Time) (int, error)
+}
+
+// DBStore keeps sessions in the database, so they survive restarts and are shared by all
+// instances of the application. It satisfies scs.Store.
+type DBStore struct {
+	DB       Store
+	ErrorLog *log.Logger
+}
+
+// New creates a new database session store
+func New(db Store, errorLog *log.Logger) *DBStore {
+	return &DBStore{
+		DB:       db,
+		ErrorLog: errorLog,
+	}
+}
+
+// Find returns the data of the session with token, found is false if it does not exist or has expired
+func (s *DBStore) Find(token string) ([]byte, bool, error) {
+	b, err := s.DB.FindSession(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit stores the data of the session with token until expiry
+func (s *DBStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.DB.CommitSession(token, b, expiry)
+}
+
+// Delete removes the session with token
+func (s *DBStore) Delete(token string) error {
+	return s.DB.DeleteSession(token)
+}
+
+// Start removes the expired sessions every interval until done is closed
+func (s *DBStore) Start(interval time.Duration, done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			_, err := s.DB.DeleteExpiredSessions()
+			if err != nil {
+				s.ErrorLog.Println("cannot remove expired sessions:", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// CleanUserSessions removes the user sessions started more than lifetime ago every interval until
+// done is closed. Their session has expired by then, whichever store keeps it.
+func CleanUserSessions(db UserSessionStore, lifetime, interval time.Duration, errorLog *log.Logger, done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			_, err := db.DeleteUserSessionsStartedBefore(time.Now().Add(-lifetime))
+			if err != nil {
+				errorLog.Println("cannot remove expired user sessions:", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
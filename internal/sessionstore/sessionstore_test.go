@@ -0,0 +1,153 @@
+package sessionstore
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+type session struct {
+	data   []byte
+	expiry time.Time
+}
+
+type fakeStore struct {
+	sessions map[string]session
+}
+
+func (s *fakeStore) FindSession(token string) ([]byte, error) {
+	sess, ok := s.sessions[token]
+	if !ok || !sess.expiry.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	return sess.data, nil
+}
+
+func (s *fakeStore) CommitSession(token string, data []byte, expiry time.Time) error {
+	s.sessions[token] = session{data: data, expiry: expiry}
+	return nil
+}
+
+func (s *fakeStore) DeleteSession(token string) error {
+	delete(s.sessions, token)
+	return nil
+}
+
+func (s *fakeStore) DeleteExpiredSessions() (int, error) {
+	n := 0
+	for token, sess := range s.sessions {
+		if !sess.expiry.After(time.Now()) {
+			delete(s.sessions, token)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func newStore() (*DBStore, *fakeStore) {
+	fake := &fakeStore{sessions: make(map[string]session)}
+	return New(fake, log.New(io.Discard, "", 0)), fake
+}
+
+func TestDBStore_Find(t *testing.T) {
+	store, fake := newStore()
+	fake.sessions["live"] = session{data: []byte("data"), expiry: time.Now().Add(time.Hour)}
+	fake.sessions["expired"] = session{data: []byte("data"), expiry: time.Now().Add(-time.Hour)}
+
+	var tests = []struct {
+		token string
+		found bool
+	}{
+		{"live", true},
+		{"expired", false},
+		{"missing", false},
+	}
+
+	for _, e := range tests {
+		b, found, err := store.Find(e.token)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.token, err)
+		}
+		if found != e.found {
+			t.Errorf("%s: expected found %t but got %t", e.token, e.found, found)
+		}
+		if found && string(b) != "data" {
+			t.Errorf("%s: expected the stored data but got %q", e.token, b)
+		}
+	}
+}
+
+func TestDBStore_SessionManager(t *testing.T) {
+	store, fake := newStore()
+
+	manager := scs.New()
+	manager.Store = store
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/put", func(w http.ResponseWriter, r *http.Request) {
+		manager.Put(r.Context(), "user_id", 7)
+	})
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		if manager.GetInt(r.Context(), "user_id") != 7 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	mux.HandleFunc("/destroy", func(w http.ResponseWriter, r *http.Request) {
+		_ = manager.Destroy(r.Context())
+	})
+	handler := manager.LoadAndSave(mux)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/put", nil))
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || len(fake.sessions) != 1 {
+		t.Fatalf("expected the session to be stored, got %d cookies and %d sessions", len(cookies), len(fake.sessions))
+	}
+
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the session to be loaded from the store but got status %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/destroy", nil)
+	req.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if len(fake.sessions) != 0 {
+		t.Errorf("expected the session to be deleted, %d left", len(fake.sessions))
+	}
+}
+
+type fakeUserSessions struct {
+	before chan time.Time
+}
+
+func (s *fakeUserSessions) DeleteUserSessionsStartedBefore(t time.Time) (int, error) {
+	s.before <- t
+	return 0, nil
+}
+
+func TestCleanUserSessions(t *testing.T) {
+	fake := &fakeUserSessions{before: make(chan time.Time, 1)}
+	done := make(chan struct{})
+	defer close(done)
+
+	CleanUserSessions(fake, time.Hour, time.Hour, log.New(io.Discard, "", 0), done)
+
+	select {
+	case before := <-fake.before:
+		if age := time.Since(before); age < 59*time.Minute || age > 61*time.Minute {
+			t.Errorf("expected the user sessions older than the lifetime to be removed, got a cutoff %s ago", age)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("user sessions were not cleaned up")
+	}
+}
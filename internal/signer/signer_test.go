@@ -0,0 +1,47 @@
+package signer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	s := New([]byte("secret"))
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	token := s.Sign("booking", 42, now.Add(time.Hour))
+
+	id, err := s.Verify("booking", token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Errorf("expected id 42 but got %d", id)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	s := New([]byte("secret"))
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := s.Sign("booking", 42, now.Add(time.Hour))
+
+	if _, err := s.Verify("booking", token, now.Add(2*time.Hour)); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+
+	if _, err := s.Verify("device", token, now); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another purpose, got %v", err)
+	}
+
+	if _, err := New([]byte("other")).Verify("booking", token, now); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another key, got %v", err)
+	}
+
+	forged := s.Sign("booking", 43, now.Add(time.Hour))
+	tampered := forged[:len(forged)/2] + token[len(token)/2:]
+	for _, bad := range []string{"", "abc", "abc.def", tampered} {
+		if _, err := s.Verify("booking", bad, now); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken for %q, got %v", bad, err)
+		}
+	}
+}
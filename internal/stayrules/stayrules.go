@@ -0,0 +1,83 @@
+package stayrules
+
+import (
+	"bookings/internal/models"
+	"bookings/internal/repository"
+	"fmt"
+	"time"
+)
+
+// Violation is returned when a stay breaks a stay rule, Reason is suitable for showing to guests
+type Violation struct {
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// Checker checks stays against the rules stored in the database
+type Checker struct {
+	DB repository.DatabaseRepo
+}
+
+// NewChecker creates a new stay rule checker
+func NewChecker(db repository.DatabaseRepo) *Checker {
+	return &Checker{
+		DB: db,
+	}
+}
+
+// CheckStay returns a *Violation if a stay in a room from start to end breaks one of its rules
+func (c *Checker) CheckStay(roomID int, start, end time.Time) error {
+	rules, err := c.DB.GetStayRulesForRoomByDate(roomID, start, end)
+	if err != nil {
+		return err
+	}
+
+	return Check(rules, start, end)
+}
+
+// Check returns a *Violation for the first rule the stay from start (arrival) to end (departure) breaks.
+// Night limits and closed-to-arrival days apply when the arrival date is within a rule's dates,
+// closed-to-departure days when the departure date is.
+func Check(rules []models.StayRule, start, end time.Time) error {
+	nights := int(end.Sub(start).Hours() / 24)
+	if nights < 1 {
+		return &Violation{Reason: "Departure must be after arrival"}
+	}
+
+	for _, rule := range rules {
+		if covers(rule, start) {
+			if rule.MinNights > 0 && nights < rule.MinNights {
+				return &Violation{Reason: fmt.Sprintf("Stays arriving on %s must be at least %d nights", start.Format("2006-01-02"), rule.MinNights)}
+			}
+			if rule.MaxNights > 0 && nights > rule.MaxNights {
+				return &Violation{Reason: fmt.Sprintf("Stays arriving on %s can be at most %d nights", start.Format("2006-01-02"), rule.MaxNights)}
+			}
+			if hasWeekday(rule.ClosedToArrival, start.Weekday()) {
+				return &Violation{Reason: fmt.Sprintf("Arrivals are not possible on %ss", start.Weekday())}
+			}
+		}
+
+		if covers(rule, end) && hasWeekday(rule.ClosedToDeparture, end.Weekday()) {
+			return &Violation{Reason: fmt.Sprintf("Departures are not possible on %ss", end.Weekday())}
+		}
+	}
+
+	return nil
+}
+
+// covers reports whether d falls within the dates of a rule
+func covers(rule models.StayRule, d time.Time) bool {
+	return !d.Before(rule.StartDate) && !d.After(rule.EndDate)
+}
+
+func hasWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package stayrules
+
+import (
+	"bookings/internal/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+var rules = []models.StayRule{
+	{
+		StartDate:         date("2050-07-01"),
+		EndDate:           date("2050-07-31"),
+		MinNights:         3,
+		MaxNights:         7,
+		ClosedToArrival:   []time.Weekday{time.Sunday},
+		ClosedToDeparture: []time.Weekday{time.Saturday},
+	},
+}
+
+// 2050-07-01 is a Friday
+var checkTests = []struct {
+	name    string
+	start   string
+	end     string
+	allowed bool
+}{
+	{"within limits", "2050-07-04", "2050-07-07", true},
+	{"too short", "2050-07-04", "2050-07-06", false},
+	{"too long", "2050-07-04", "2050-07-14", false},
+	{"closed to arrival", "2050-07-03", "2050-07-07", false},
+	{"closed to departure", "2050-07-05", "2050-07-09", false},
+	{"departure after the rule", "2050-07-29", "2050-08-01", true},
+	{"arrival before the rule", "2050-06-30", "2050-07-01", true},
+	{"no nights", "2050-07-04", "2050-07-04", false},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		err := Check(rules, date(e.start), date(e.end))
+
+		var v *Violation
+		if e.allowed && err != nil {
+			t.Errorf("%s: expected stay to be allowed, got %v", e.name, err)
+		}
+		if !e.allowed && !errors.As(err, &v) {
+			t.Errorf("%s: expected a violation, got %v", e.name, err)
+		}
+		if v != nil && v.Reason == "" {
+			t.Errorf("%s: violation has no reason", e.name)
+		}
+	}
+}
+
+var lengthRules = []models.StayRule{
+	{StartDate: date("2050-08-01"), EndDate: date("2050-08-31"), MinNights: 3, MaxNights: 7},
+	{StartDate: date("2050-09-01"), EndDate: date("2050-09-30"), MinNights: 2},
+	{StartDate: date("2050-10-01"), EndDate: date("2050-10-31"), MaxNights: 4},
+}
+
+var lengthTests = []struct {
+	name    string
+	start   string
+	end     string
+	allowed bool
+	reason  string
+}{
+	{"one night under the minimum", "2050-08-10", "2050-08-12", false, "at least 3 nights"},
+	{"exactly the minimum", "2050-08-10", "2050-08-13", true, ""},
+	{"exactly the maximum", "2050-08-10", "2050-08-17", true, ""},
+	{"one night over the maximum", "2050-08-10", "2050-08-18", false, "at most 7 nights"},
+	{"minimum only, long stay", "2050-09-10", "2050-09-30", true, ""},
+	{"minimum only, one night", "2050-09-10", "2050-09-11", false, "at least 2 nights"},
+	{"maximum only, one night", "2050-10-10", "2050-10-11", true, ""},
+	{"maximum only, too long", "2050-10-10", "2050-10-15", false, "at most 4 nights"},
+	{"arrival on the last day of a rule", "2050-08-31", "2050-09-01", false, "at least 3 nights"},
+	{"arrival the day before a rule", "2050-07-31", "2050-08-01", true, ""},
+	{"rule of the arrival date applies", "2050-08-29", "2050-09-09", false, "at most 7 nights"},
+}
+
+func TestCheckStayLength(t *testing.T) {
+	for _, e := range lengthTests {
+		err := Check(lengthRules, date(e.start), date(e.end))
+
+		if e.allowed {
+			if err != nil {
+				t.Errorf("%s: expected stay to be allowed, got %v", e.name, err)
+			}
+			continue
+		}
+
+		var v *Violation
+		if !errors.As(err, &v) {
+			t.Errorf("%s: expected a violation, got %v", e.name, err)
+			continue
+		}
+		if !strings.Contains(v.Reason, e.reason) {
+			t.Errorf("%s: expected reason to mention %q, got %q", e.name, e.reason, v.Reason)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, keeping the last 6 of the 8 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("at %d got %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	step, ok := Verify(rfcSecret, "050471", now)
+	if !ok || step != Step(now) {
+		t.Errorf("current code got %d %v", step, ok)
+	}
+
+	// 1111111109 falls in the period before, whose code is still accepted
+	if _, ok := Verify(rfcSecret, "081804", now); !ok {
+		t.Error("code of the previous period was refused")
+	}
+
+	if _, ok := Verify(rfcSecret, "050471", now.Add(3*Period)); ok {
+		t.Error("old code was accepted")
+	}
+
+	for _, bad := range []string{"", "05047", "0504711", "123456"} {
+		if _, ok := Verify(rfcSecret, bad, now); ok {
+			t.Errorf("code %q was accepted", bad)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(secret) != 32 {
+		t.Errorf("got secret of length %d, want 32", len(secret))
+	}
+
+	code, err := Code(secret, Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Verify(secret, code, time.Now()); !ok {
+		t.Error("code of a generated secret was refused")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Fort Smythe", "admin@bookings.com", rfcSecret)
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Fort%20Smythe:admin@bookings.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+rfcSecret) || !strings.Contains(uri, "issuer=Fort+Smythe") {
+		t.Errorf("missing secret or issuer in %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := RecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected recovery code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q repeated", code)
+		}
+		seen[code] = true
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" ") {
+		t.Error("recovery code typed differently does not match")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("different recovery codes have the same hash")
+	}
+}
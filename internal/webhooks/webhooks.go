@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"bookings/internal/models"
+	"bookings/internal/outbox"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the webhook secret.
+const (
+	HeaderEvent     = "X-Bookings-Event"
+	HeaderDelivery  = "X-Bookings-Delivery"
+	HeaderTimestamp = "X-Bookings-Timestamp"
+	HeaderSignature = "X-Bookings-Signature"
+)
+
+// DefaultMaxAttempts is how often a delivery is tried before it is marked as failed
+const DefaultMaxAttempts = 8
+
+const (
+	// batchSize is the number of deliveries claimed per poll
+	batchSize = 20
+	// lease keeps a claimed delivery away from other workers while it is being sent
+	lease = 5 * time.Minute
+	// maxErrorBody is how much of an error response is kept in the delivery log
+	maxErrorBody = 512
+)
+
+// Store is the part of the database repository used by the dispatcher
+type Store interface {
+	ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	MarkWebhookDelivered(id, responseStatus int) error
+	MarkWebhookFailed(id, responseStatus int, lastError string, nextAttempt time.Time, dead bool) error
+}
+
+// Payload is the body posted to webhooks
+type Payload struct {
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Dispatcher delivers the events queued for the webhooks, retrying failures with the same backoff as emails
+type Dispatcher struct {
+	DB          Store
+	Client      *http.Client
+	MaxAttempts int
+	ErrorLog    *log.Logger
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(db Store, errorLog *log.Logger) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: DefaultMaxAttempts,
+		ErrorLog:    errorLog,
+	}
+}
+
+// NewMessage encodes an event with its data into the message queued for the webhooks subscribing to it
+func NewMessage(event string, data interface{}) (models.WebhookMessage, error) {
+	payload, err := json.Marshal(Payload{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return models.WebhookMessage{}, err
+	}
+
+	return models.WebhookMessage{Event: event, Payload: payload}, nil
+}
+
+// Start polls for due deliveries every interval until done is closed
+func (d *Dispatcher) Start(interval time.Duration, done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			err := d.Deliver(time.Now())
+			if err != nil {
+				d.ErrorLog.Println(err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Deliver posts the deliveries that are due and records the outcome of each attempt
+func (d *Dispatcher) Deliver(now time.Time) error {
+	deliveries, err := d.DB.ClaimDueWebhookDeliveries(batchSize, lease)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		status, err := d.send(delivery, now)
+		if err == nil {
+			err = d.DB.MarkWebhookDelivered(delivery.ID, status)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		dead := attempts >= d.MaxAttempts
+		if dead {
+			d.ErrorLog.Printf("giving up on webhook delivery %d to %s after %d attempts: %v",
+				delivery.ID, delivery.Webhook.URL, attempts, err)
+		}
+
+		err = d.DB.MarkWebhookFailed(delivery.ID, status, err.Error(), now.Add(outbox.Backoff(attempts)), dead)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send posts one delivery and returns the response status. Anything but a 2xx answer is an error.
+func (d *Dispatcher) send(delivery models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bookings-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, fmt.Errorf("webhook answered %s: %s", resp.Status, bytes.TrimSpace(answer))
+	}
+
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"bookings/internal/models"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type failure struct {
+	id     int
+	status int
+	next   time.Time
+	dead   bool
+}
+
+type fakeStore struct {
+	due       []models.WebhookDelivery
+	delivered []int
+	failed    []failure
+}
+
+func (s *fakeStore) ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *fakeStore) MarkWebhookDelivered(id, responseStatus int) error {
+	s.delivered = append(s.delivered, id)
+	return nil
+}
+
+func (s *fakeStore) MarkWebhookFailed(id, responseStatus int, lastError string, nextAttempt time.Time, dead bool) error {
+	s.failed = append(s.failed, failure{id: id, status: responseStatus, next: nextAttempt, dead: dead})
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	// printf '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+
+	if got := Sign("secret", 1700000000, []byte(`{"a":1}`)); got != expected {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+	if Sign("secret", 1700000001, []byte(`{"a":1}`)) == expected {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestNewMessage(t *testing.T) {
+	msg, err := NewMessage(models.EventReservationCreated, map[string]int{"id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Event != models.EventReservationCreated {
+		t.Errorf("unexpected event %s", msg.Event)
+	}
+
+	var payload struct {
+		Event string         `json:"event"`
+		Data  map[string]int `json:"data"`
+	}
+	err = json.Unmarshal(msg.Payload, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != models.EventReservationCreated || payload.Data["id"] != 7 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	body := `{"event":"reservation.created"}`
+
+	var got *http.Request
+	var gotBody []byte
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	store := &fakeStore{
+		due: []models.WebhookDelivery{
+			{ID: 1, Event: models.EventReservationCreated, Payload: body,
+				Webhook: models.Webhook{URL: ok.URL, Secret: "secret"}},
+			{ID: 2, Event: models.EventReservationCreated, Payload: body, Attempts: 0,
+				Webhook: models.Webhook{URL: down.URL}},
+			{ID: 3, Event: models.EventReservationCreated, Payload: body, Attempts: DefaultMaxAttempts - 1,
+				Webhook: models.Webhook{URL: down.URL}},
+		},
+	}
+	d := NewDispatcher(store, log.New(io.Discard, "", 0))
+
+	err := d.Deliver(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.delivered) != 1 || store.delivered[0] != 1 {
+		t.Errorf("expected delivery 1 to succeed, got %v", store.delivered)
+	}
+
+	if got == nil {
+		t.Fatal("webhook was not called")
+	}
+	if string(gotBody) != body {
+		t.Errorf("unexpected body %s", gotBody)
+	}
+	if got.Header.Get(HeaderEvent) != models.EventReservationCreated || got.Header.Get(HeaderDelivery) != "1" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+	if got.Header.Get(HeaderTimestamp) != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("unexpected timestamp %s", got.Header.Get(HeaderTimestamp))
+	}
+	if got.Header.Get(HeaderSignature) != Sign("secret", now.Unix(), []byte(body)) {
+		t.Error("signature does not match")
+	}
+
+	if len(store.failed) != 2 {
+		t.Fatalf("expected 2 failures, got %v", store.failed)
+	}
+	if f := store.failed[0]; f.id != 2 || f.dead || f.status != http.StatusBadGateway || !f.next.Equal(now.Add(30*time.Second)) {
+		t.Errorf("unexpected first failure %+v", f)
+	}
+	if f := store.failed[1]; f.id != 3 || !f.dead {
+		t.Errorf("expected delivery 3 to be given up, got %+v", f)
+	}
+}
@@ -0,0 +1 @@
+UPDATE public.rooms SET slug = '', description = '', images = '', capacity = 2, amenities = '';
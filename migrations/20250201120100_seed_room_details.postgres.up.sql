@@ -0,0 +1,17 @@
+UPDATE public.rooms SET
+	slug = 'generals-quarters',
+	description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.',
+	images = 'generals-quarters.png',
+	capacity = 2,
+	amenities = E'Ocean view\nQueen bed\nPrivate bathroom'
+WHERE room_name = 'General''s Quaters';
+
+UPDATE public.rooms SET
+	slug = 'majors-suite',
+	description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.',
+	images = 'majors-suite.png',
+	capacity = 4,
+	amenities = E'Ocean view\nKing bed\nSitting area\nPrivate bathroom'
+WHERE room_name = 'Major''s Suite';
+
+UPDATE public.rooms SET slug = 'room-' || id WHERE slug = '';
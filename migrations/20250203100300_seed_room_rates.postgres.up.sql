@@ -0,0 +1,2 @@
+UPDATE public.rooms SET nightly_rate = 12000, weekend_uplift = 15 WHERE slug = 'generals-quarters';
+UPDATE public.rooms SET nightly_rate = 18000, weekend_uplift = 15 WHERE slug = 'majors-suite';
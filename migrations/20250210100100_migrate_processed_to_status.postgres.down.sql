@@ -0,0 +1,3 @@
+ALTER TABLE public.reservations ADD COLUMN processed integer NOT NULL DEFAULT 0;
+
+UPDATE public.reservations SET processed = 1 WHERE status <> 'pending';
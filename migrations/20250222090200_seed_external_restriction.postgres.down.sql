@@ -0,0 +1,2 @@
+DELETE FROM public.room_restrictions WHERE restriction_id = 3;
+DELETE FROM public.restrictions WHERE id = 3;
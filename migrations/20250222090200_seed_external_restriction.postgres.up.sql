@@ -0,0 +1,4 @@
+INSERT INTO public.restrictions (id,restriction_name,created_at,updated_at) VALUES
+	 (3,'External',now(),now());
+
+SELECT setval(pg_get_serial_sequence('public.restrictions', 'id'), (SELECT max(id) FROM public.restrictions));
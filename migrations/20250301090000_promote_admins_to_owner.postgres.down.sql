@@ -0,0 +1 @@
+UPDATE public.users SET access_level = 3 WHERE access_level = 4;
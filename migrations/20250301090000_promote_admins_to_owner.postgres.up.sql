@@ -0,0 +1,2 @@
+-- admins were seeded with level 3, which is now the manager role; keep their full access as owners
+UPDATE public.users SET access_level = 4 WHERE access_level = 3;
@@ -0,0 +1,2 @@
+DROP TRIGGER audit_events_append_only ON public.audit_events;
+DROP FUNCTION audit_events_append_only();
@@ -61,7 +61,7 @@ function handleCheckAvailability(event, roomId, CSRFToken) {
                             `,
                         });
                     } else {
-                        attention.error({msg:"No availability"});
+                        attention.error({msg: data.message});
                     }
                 })
         }